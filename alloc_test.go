@@ -0,0 +1,77 @@
+package macros
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplaceAllocs(t *testing.T) {
+	tpl := Must("?id=${ID:urlquery}&price=${PRICE}&n=${N}&u=${U}&ts=${TS}&h=${ID:hex}&b=${ID:base64}", Filters{
+		"urlquery": QueryEscape,
+		"hex":      Hex,
+		"base64":   Base64URL,
+	})
+	now := time.Now()
+	buf := make([]byte, 0, 1024)
+	var err error
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, err = tpl.Replace(buf[:0],
+			String("ID", "foo bar/baz"),
+			Float64("PRICE", 4.2),
+			Int("N", -42),
+			Uint("U", 42),
+			Time("TS", now, time.RFC3339Nano),
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs != 0 {
+		t.Errorf("Replace allocates %f times per run", allocs)
+	}
+}
+
+func TestRenderAllocs(t *testing.T) {
+	tpl := Must("?id=${ID}&price=${PRICE}&ts=${TS}")
+	now := time.Unix(1500000000, 0).UTC()
+	buf, release, err := tpl.Render(String("ID", "foo"), Float64("PRICE", 4.2), Time("TS", now, time.RFC3339))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "?id=foo&price=4.2&ts=2017-07-14T02:40:00Z" {
+		t.Errorf("Invalid render %q", buf)
+	}
+	release()
+	if _, _, err := tpl.Render(); err != ErrMacroNotFound {
+		t.Errorf("Invalid error %v", err)
+	}
+	if raceEnabled {
+		t.Skip("sync.Pool drops items randomly under the race detector")
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, release, err = tpl.Render(String("ID", "foo"), Float64("PRICE", 4.2), Time("TS", now, time.RFC3339))
+		release()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The release function bound to each render is the only allocation
+	if allocs != 1 {
+		t.Errorf("Render allocates %f times per run", allocs)
+	}
+}
+
+func TestReplaceLoopAllocs(t *testing.T) {
+	tpl := Must("${*L}${.}${/L}")
+	buf := make([]byte, 0, 1024)
+	list := List("L", String("", "a"), String("", "b"))
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = tpl.Replace(buf[:0], list)
+	})
+	if string(buf) != "ab" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if allocs != 0 {
+		t.Errorf("Replace allocates %f times per run", allocs)
+	}
+}
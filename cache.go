@@ -0,0 +1,155 @@
+package macros
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// Cache is a concurrency-safe LRU cache of templates parsed by a Replacer
+type Cache struct {
+	replacer   *Replacer
+	maxEntries int
+	maxSize    int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List
+	size    int
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+type cacheEntry struct {
+	src  string
+	tpl  *Template
+	err  error
+	done chan struct{}
+}
+
+// CacheStats are the statistics of a Cache
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Size    int
+}
+
+// NewCache creates a new template cache for `r`.
+// A cache holds up to `maxEntries` templates with a total source size of up to `maxSize` bytes.
+// Zero or negative limits are ignored.
+func NewCache(r *Replacer, maxEntries, maxSize int) *Cache {
+	if r == nil {
+		r = New()
+	}
+	return &Cache{
+		replacer:   r,
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Replace appends the template `src` to `buf` replacing tokens with values.
+// It is a drop-in replacement for `Replacer.Replace` that parses each template source once.
+func (c *Cache) Replace(buf []byte, src string, values ...Value) ([]byte, error) {
+	tpl, err := c.Parse(src)
+	if err != nil {
+		return buf, err
+	}
+	return tpl.Replace(buf, values...)
+}
+
+// Parse returns the cached template for `src`, parsing it on a cache miss.
+// Concurrent misses for the same source wait for a single parse and count as misses if it fails.
+func (c *Cache) Parse(src string) (*Template, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[src]; ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*cacheEntry)
+		c.mu.Unlock()
+		<-e.done
+		if e.err != nil {
+			c.misses.Add(1)
+		} else {
+			c.hits.Add(1)
+		}
+		return e.tpl, e.err
+	}
+	c.misses.Add(1)
+	e := &cacheEntry{
+		src:  src,
+		done: make(chan struct{}),
+	}
+	c.entries[src] = c.lru.PushFront(e)
+	c.size += len(src)
+	c.mu.Unlock()
+
+	e.tpl, e.err = c.replacer.Parse(src)
+	close(e.done)
+	c.mu.Lock()
+	if e.err != nil {
+		// Do not cache parse errors
+		if el, ok := c.entries[src]; ok && el.Value == e {
+			c.remove(el)
+		}
+	} else {
+		c.evict()
+	}
+	c.mu.Unlock()
+	return e.tpl, e.err
+}
+
+// Stats returns the cache statistics
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.lru.Len(),
+		Size:    c.size,
+	}
+}
+
+// Reset removes all cached templates and resets statistics
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	c.hits.Store(0)
+	c.misses.Store(0)
+}
+
+// evict removes least recently used entries over the limits.
+// The most recent entry and entries that are still parsing are kept.
+func (c *Cache) evict() {
+	for el := c.lru.Back(); el != c.lru.Front() && c.full(); {
+		prev := el.Prev()
+		if e := el.Value.(*cacheEntry); e.parsed() {
+			c.remove(el)
+		}
+		el = prev
+	}
+}
+
+func (c *Cache) full() bool {
+	return c.maxEntries > 0 && c.lru.Len() > c.maxEntries || c.maxSize > 0 && c.size > c.maxSize
+}
+
+func (e *cacheEntry) parsed() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.src)
+	c.size -= len(e.src)
+}
@@ -0,0 +1,119 @@
+package macros
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(New(Alias("FOO", "foo")), 2, 0)
+	for i := 0; i < 2; i++ {
+		buf, err := c.Replace(nil, "${foo} ${BAR}", String("FOO", "foo"), String("BAR", "bar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != "foo bar" {
+			t.Errorf("Invalid replacement %q", buf)
+		}
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+	c.Parse("${A}")
+	c.Parse("${B}")
+	if stats := c.Stats(); stats.Entries != 2 || stats.Size != 8 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+	c.Parse("${A}")
+	if stats := c.Stats(); stats.Hits != 2 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+	c.Parse("${foo} ${BAR}")
+	if stats := c.Stats(); stats.Misses != 4 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+	if _, err := c.Parse("${B"); err == nil {
+		t.Errorf("Expected parse error")
+	}
+	if stats := c.Stats(); stats.Entries != 2 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+	c.Reset()
+	if stats := c.Stats(); stats != (CacheStats{}) {
+		t.Errorf("Invalid stats %v", stats)
+	}
+}
+
+func TestCacheMaxSize(t *testing.T) {
+	c := NewCache(nil, 0, 10)
+	c.Parse("${A}")
+	c.Parse("${B}")
+	c.Parse("${C}")
+	if stats := c.Stats(); stats.Entries != 2 || stats.Size != 8 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := NewCache(nil, 8, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			n := strconv.Itoa(i % 4)
+			buf, err := c.Replace(nil, "${N}-"+n, String("N", n))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(buf) != n+"-"+n {
+				t.Errorf("Invalid replacement %q", buf)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats := c.Stats(); stats.Misses != 4 || stats.Hits != 60 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+}
+
+func TestCacheInFlight(t *testing.T) {
+	c := NewCache(nil, 1, 0)
+	// Simulate a parse in progress
+	e := &cacheEntry{src: "${X", done: make(chan struct{})}
+	c.entries[e.src] = c.lru.PushFront(e)
+	c.size += len(e.src)
+	c.Parse("${A}")
+	if el, ok := c.entries[e.src]; !ok || el.Value != e {
+		t.Fatalf("In-flight entry evicted")
+	}
+	if _, ok := c.entries["${A}"]; !ok {
+		t.Fatalf("Most recent entry evicted")
+	}
+	done := make(chan error)
+	go func() {
+		_, err := c.Parse(e.src)
+		done <- err
+	}()
+	for {
+		// Wait for the waiter to block on the in-flight parse
+		c.mu.Lock()
+		front := c.lru.Front().Value == e
+		c.mu.Unlock()
+		if front {
+			break
+		}
+		runtime.Gosched()
+	}
+	e.err = errEOF
+	close(e.done)
+	if err := <-done; err != errEOF {
+		t.Errorf("Invalid error %v", err)
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("Invalid stats %v", stats)
+	}
+}
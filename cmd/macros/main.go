@@ -0,0 +1,515 @@
+// Command macros renders, lints and inspects macro templates
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alxarch/macros"
+)
+
+const usage = `Usage: macros <command> [options] [template]
+
+Commands:
+  render   Render a template with values from flags, env, a JSON file or stdin
+  lint     Report unmatched delimiters, unknown filters and unused aliases
+  list     Print the macros and filters used by a template
+  url      Convert a URL to a template with macro query parameters
+  gen      Generate a typed Go render function from a template (for go:generate)
+
+Run 'macros <command> -h' for command options.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("Invalid command")
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errUsage
+	}
+	cmd := command{
+		stdin:  stdin,
+		stdout: stdout,
+		flags:  flag.NewFlagSet("macros "+args[0], flag.ContinueOnError),
+	}
+	cmd.flags.SetOutput(stderr)
+	switch args[0] {
+	case "render":
+		return cmd.render(args[1:])
+	case "lint":
+		return cmd.lint(args[1:])
+	case "list":
+		return cmd.list(args[1:])
+	case "url":
+		return cmd.url(args[1:])
+	case "gen":
+		return cmd.gen(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, usage)
+		return errUsage
+	}
+}
+
+type command struct {
+	stdin  io.Reader
+	stdout io.Writer
+	flags  *flag.FlagSet
+
+	start   string
+	end     string
+	filters string
+	config  string
+	file    string
+	alias   multiFlag
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// parse parses common flags
+func (cmd *command) parse(args []string) error {
+	start, end := macros.DefaultDelimiters()
+	names := make([]string, 0, 4)
+	for name := range macros.DefaultFilters() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cmd.flags.StringVar(&cmd.start, "start", start, "Start delimiter")
+	cmd.flags.StringVar(&cmd.end, "end", end, "End delimiter")
+	cmd.flags.StringVar(&cmd.filters, "filters", strings.Join(names, ","), "Comma separated list of available filters")
+	cmd.flags.StringVar(&cmd.config, "config", "", "JSON or YAML configuration file")
+	cmd.flags.StringVar(&cmd.file, "f", "", "Read template from file ('-' for stdin)")
+	cmd.flags.Var(&cmd.alias, "alias", "Macro aliases as MACRO=ALIAS[,ALIAS...] (repeatable)")
+	return cmd.flags.Parse(args)
+}
+
+func (cmd *command) filterSet() (macros.Filters, error) {
+	registry := macros.DefaultFilters()
+	filters := macros.Filters{}
+	for _, name := range strings.Split(cmd.filters, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		filter := registry[name]
+		if filter == nil {
+			return nil, fmt.Errorf("Unknown filter %q", name)
+		}
+		filters[name] = filter
+	}
+	return filters, nil
+}
+
+func (cmd *command) aliases() (map[macros.Token][]macros.Token, error) {
+	aliases := make(map[macros.Token][]macros.Token)
+	for _, a := range cmd.alias {
+		pos := strings.IndexByte(a, '=')
+		if pos == -1 {
+			return nil, fmt.Errorf("Invalid alias %q", a)
+		}
+		macro := macros.Token(a[:pos])
+		for _, alias := range strings.Split(a[pos+1:], ",") {
+			aliases[macro] = append(aliases[macro], macros.Token(alias))
+		}
+	}
+	return aliases, nil
+}
+
+// options returns the options from flags and the configuration file except for aliases.
+// Aliases from the configuration file and flags are merged and returned separately.
+func (cmd *command) options() ([]macros.Option, map[macros.Token][]macros.Token, error) {
+	filters, err := cmd.filterSet()
+	if err != nil {
+		return nil, nil, err
+	}
+	options := []macros.Option{
+		macros.Delimiters(cmd.start, cmd.end),
+		filters,
+		macros.DefaultArgFilters(),
+	}
+	aliases := make(map[macros.Token][]macros.Token)
+	if cmd.config != "" {
+		f, err := os.Open(cmd.config)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		load := macros.LoadConfig
+		switch filepath.Ext(cmd.config) {
+		case ".yaml", ".yml":
+			load = macros.LoadConfigYAML
+		}
+		c, err := load(cmd.config, f)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Validate the full configuration before separating the aliases
+		if _, err := c.Options(macros.DefaultFilters()); err != nil {
+			return nil, nil, err
+		}
+		for macro, a := range c.Alias {
+			aliases[macro] = append(aliases[macro], a...)
+		}
+		c.Alias = nil
+		configOptions, err := c.Options(macros.DefaultFilters())
+		if err != nil {
+			return nil, nil, err
+		}
+		options = append(options, configOptions...)
+	}
+	flagAliases, err := cmd.aliases()
+	if err != nil {
+		return nil, nil, err
+	}
+	for macro, a := range flagAliases {
+		aliases[macro] = append(aliases[macro], a...)
+	}
+	return options, aliases, nil
+}
+
+// replacer creates a Replacer from flags and the configuration file
+func (cmd *command) replacer(withAliases bool) (*macros.Replacer, map[macros.Token][]macros.Token, error) {
+	options, aliases, err := cmd.options()
+	if err != nil {
+		return nil, nil, err
+	}
+	if withAliases {
+		names := make([]string, 0, len(aliases))
+		for macro := range aliases {
+			names = append(names, string(macro))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			macro := macros.Token(name)
+			options = append(options, macros.Alias(macro, aliases[macro]...))
+		}
+	}
+	return macros.New(options...), aliases, nil
+}
+
+// source reads the template from a file, stdin or the first argument
+func (cmd *command) source() (string, error) {
+	switch {
+	case cmd.file == "-":
+		data, err := io.ReadAll(cmd.stdin)
+		return string(data), err
+	case cmd.file != "":
+		data, err := os.ReadFile(cmd.file)
+		return string(data), err
+	case cmd.flags.NArg() == 1:
+		return cmd.flags.Arg(0), nil
+	default:
+		return "", errors.New("No template provided")
+	}
+}
+
+func (cmd *command) template(withAliases bool) (*macros.Template, error) {
+	src, err := cmd.source()
+	if err != nil {
+		return nil, err
+	}
+	r, _, err := cmd.replacer(withAliases)
+	if err != nil {
+		return nil, err
+	}
+	return r.Parse(src)
+}
+
+func (cmd *command) render(args []string) error {
+	var (
+		values   multiFlag
+		jsonFile string
+		env      bool
+	)
+	cmd.flags.Var(&values, "v", "Macro value as MACRO=VALUE (repeatable)")
+	cmd.flags.StringVar(&jsonFile, "json", "", "Read values from a JSON object file ('-' for stdin)")
+	cmd.flags.BoolVar(&env, "env", false, "Use environment variables as values")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if jsonFile == "-" && cmd.file == "-" {
+		return errors.New("Cannot read both template and values from stdin")
+	}
+	tpl, err := cmd.template(true)
+	if err != nil {
+		return err
+	}
+	var vs []macros.Value
+	for _, v := range values {
+		pos := strings.IndexByte(v, '=')
+		if pos == -1 {
+			return fmt.Errorf("Invalid value %q", v)
+		}
+		vs = append(vs, macros.String(macros.Token(v[:pos]), v[pos+1:]))
+	}
+	if jsonFile != "" {
+		jsonValues, err := cmd.readJSON(jsonFile)
+		if err != nil {
+			return err
+		}
+		vs = append(vs, jsonValues...)
+	}
+	if env {
+		for _, kv := range os.Environ() {
+			if pos := strings.IndexByte(kv, '='); pos > 0 {
+				vs = append(vs, macros.String(macros.Token(kv[:pos]), kv[pos+1:]))
+			}
+		}
+	}
+	buf, err := tpl.Replace(nil, vs...)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.stdout.Write(buf)
+	return err
+}
+
+func (cmd *command) readJSON(name string) ([]macros.Value, error) {
+	var r io.Reader = cmd.stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var obj map[string]interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]macros.Value, 0, len(obj))
+	for _, k := range keys {
+		values = append(values, jsonValue(macros.Token(k), obj[k]))
+	}
+	return values, nil
+}
+
+func jsonValue(macro macros.Token, v interface{}) macros.Value {
+	switch v := v.(type) {
+	case string:
+		return macros.String(macro, v)
+	case bool:
+		return macros.Bool(macro, v)
+	case []interface{}:
+		items := make([]macros.Value, len(v))
+		for i, item := range v {
+			items[i] = jsonValue("", item)
+		}
+		return macros.List(macro, items...)
+	case nil:
+		return macros.String(macro, "")
+	default:
+		return macros.Any(macro, v)
+	}
+}
+
+func (cmd *command) lint(args []string) error {
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	src, err := cmd.source()
+	if err != nil {
+		return err
+	}
+	r, aliases, err := cmd.replacer(false)
+	if err != nil {
+		return err
+	}
+	// Parse without aliases to check the macros as written
+	tpl, err := r.Parse(src)
+	if err != nil {
+		fmt.Fprintln(cmd.stdout, err)
+		return errLint
+	}
+	var problems []string
+	used := make(map[macros.Token]bool)
+	for _, token := range tpl.Tokens() {
+		used[macros.Token(token.Macro())] = true
+		for _, name := range token.Filters() {
+			if !r.HasFilter(name) {
+				problems = append(problems, fmt.Sprintf("Unknown filter %q in %q", name, token))
+			}
+		}
+	}
+	for macro, a := range aliases {
+		for _, alias := range a {
+			if !used[alias] {
+				problems = append(problems, fmt.Sprintf("Unused alias %q for %q", alias, macro))
+			}
+		}
+	}
+	sort.Strings(problems)
+	for _, p := range problems {
+		fmt.Fprintln(cmd.stdout, p)
+	}
+	if len(problems) > 0 {
+		return errLint
+	}
+	return nil
+}
+
+var errLint = errors.New("Lint failed")
+
+func (cmd *command) list(args []string) error {
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	tpl, err := cmd.template(true)
+	if err != nil {
+		return err
+	}
+	var (
+		names   []string
+		filters []string
+		seen    = make(map[string]bool)
+	)
+	for _, token := range tpl.Tokens() {
+		if m := token.Macro(); !seen["macro:"+m] {
+			seen["macro:"+m] = true
+			names = append(names, m)
+		}
+		for _, f := range token.Filters() {
+			if !seen["filter:"+f] {
+				seen["filter:"+f] = true
+				filters = append(filters, f)
+			}
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(filters)
+	fmt.Fprintln(cmd.stdout, "macros:")
+	for _, name := range names {
+		fmt.Fprintln(cmd.stdout, "  "+name)
+	}
+	fmt.Fprintln(cmd.stdout, "filters:")
+	for _, f := range filters {
+		fmt.Fprintln(cmd.stdout, "  "+f)
+	}
+	return nil
+}
+
+func (cmd *command) url(args []string) error {
+	var params multiFlag
+	cmd.flags.Var(&params, "p", "Query parameter macro as KEY=MACRO (repeatable)")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	rawurl, err := cmd.source()
+	if err != nil {
+		return err
+	}
+	r, _, err := cmd.replacer(true)
+	if err != nil {
+		return err
+	}
+	query := make(map[string]macros.Token, len(params))
+	for _, p := range params {
+		pos := strings.IndexByte(p, '=')
+		if pos == -1 {
+			return fmt.Errorf("Invalid parameter %q", p)
+		}
+		query[p[:pos]] = macros.Token(p[pos+1:])
+	}
+	u, err := r.URL(strings.TrimSpace(rawurl), query)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.stdout, u)
+	return err
+}
+
+func (cmd *command) gen(args []string) error {
+	var (
+		pkg     string
+		name    string
+		output  string
+		params  multiFlag
+		filters multiFlag
+		imports multiFlag
+	)
+	cmd.flags.StringVar(&pkg, "pkg", os.Getenv("GOPACKAGE"), "Package name of the generated file")
+	cmd.flags.StringVar(&name, "func", "", "Name of the generated function")
+	cmd.flags.StringVar(&output, "o", "", "Output file (default stdout)")
+	cmd.flags.Var(&params, "p", "Function parameter as MACRO=TYPE (repeatable)")
+	cmd.flags.Var(&filters, "filter", "Go expression for a custom filter as NAME=EXPR (repeatable)")
+	cmd.flags.Var(&imports, "import", "Import path required by custom filters (repeatable)")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if pkg == "" || name == "" {
+		return errors.New("Both -pkg and -func are required")
+	}
+	fn := macros.GenFunc{
+		Name:    name,
+		Imports: imports,
+	}
+	for _, p := range params {
+		pos := strings.IndexByte(p, '=')
+		if pos == -1 {
+			return fmt.Errorf("Invalid parameter %q", p)
+		}
+		fn.Params = append(fn.Params, macros.GenParam{
+			Macro: macros.Token(p[:pos]),
+			Type:  p[pos+1:],
+		})
+	}
+	if len(filters) > 0 {
+		fn.Filters = make(map[string]string, len(filters))
+		for _, f := range filters {
+			pos := strings.IndexByte(f, '=')
+			if pos == -1 {
+				return fmt.Errorf("Invalid filter %q", f)
+			}
+			fn.Filters[f[:pos]] = f[pos+1:]
+		}
+	}
+	tpl, err := cmd.template(true)
+	if err != nil {
+		return err
+	}
+	fn.Template = tpl
+	var w io.Writer = cmd.stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return macros.Generate(w, pkg, fn)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		Args   []string
+		Stdin  string
+		Expect string
+		Fail   bool
+	}{
+		{[]string{"render", "-v", "FOO=foo bar", "${FOO:query}-${BAR}"}, "", "", true},
+		{[]string{"render", "-v", "FOO=foo bar", "-v", "BAR=1", "${FOO:query}-${BAR}"}, "", "foo+bar-1", false},
+		{[]string{"render", "-start", "{", "-end", "}", "-alias", "FOO=foo", "-json", "-", "{foo}-{BAR}"}, `{"FOO":"x","BAR":4.20}`, "x-4.20", false},
+		{[]string{"render", "-f", "-", "-v", "A=a"}, "${A}${?B}b${/B}", "a", false},
+		{[]string{"lint", "-filters", "hex", "-alias", "FOO=foo,Foo", "${foo:query} ${BAR:hex}"}, "", "Unknown filter \"query\" in \"foo:query\"\nUnused alias \"Foo\" for \"FOO\"\n", true},
+		{[]string{"lint", "${FOO"}, "", "Unmatched delimiter \"${\" at position 0\n", true},
+		{[]string{"lint", "${FOO:hex}"}, "", "", false},
+		{[]string{"lint", "${TS:add(1h):unix} ${N:mul(2):fixed(2)}"}, "", "", false},
+		{[]string{"list", "-alias", "FOO=foo", "${foo:query} ${BAR:hex:query}"}, "", "macros:\n  BAR\n  FOO\nfilters:\n  hex\n  query\n", false},
+		{[]string{"url", "-p", "id=ID", "http://example.org/?a=b"}, "", "http://example.org/?a=b&id=${ID}\n", false},
+		{[]string{"gen", "-pkg", "foo", "-func", "Render", "-p", "ID=int", "id=${ID}"}, "", "// Code generated by macros. DO NOT EDIT.\n\npackage foo\n\nimport (\n\t\"strconv\"\n)\n\n// Render renders the template \"id=${ID}\"\nfunc Render(buf []byte, id int) []byte {\n\tbuf = append(buf, \"id=\"...)\n\tbuf = strconv.AppendInt(buf, int64(id), 10)\n\treturn buf\n}\n", false},
+		{[]string{"gen", "-func", "Render", "id=${ID}"}, "", "", true},
+		{[]string{"foo"}, "", "", true},
+	} {
+		var stdout, stderr bytes.Buffer
+		err := run(tc.Args, strings.NewReader(tc.Stdin), &stdout, &stderr)
+		if tc.Fail != (err != nil) {
+			t.Errorf("%v: Unexpected error %v", tc.Args, err)
+		}
+		if stdout.String() != tc.Expect {
+			t.Errorf("%v: Invalid output %q", tc.Args, stdout.String())
+		}
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"alias": {"PRICE": ["price", "AUCTION_PRICE"]}, "filters": ["query"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	err := run([]string{"lint", "-filters", "hex", "-config", config, "-alias", "FOO=foo", "${price:query} ${foo:hex} ${N:cents}"}, nil, &stdout, &stdout)
+	if err == nil || stdout.String() != "Unused alias \"AUCTION_PRICE\" for \"PRICE\"\n" {
+		t.Errorf("Invalid lint %q %v", stdout.String(), err)
+	}
+	config = filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("alias:\n  PRICE: [price, AUCTION_PRICE]\nfilters: [query]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	err = run([]string{"lint", "-config", config, "${price:query}"}, nil, &stdout, &stdout)
+	if err == nil || stdout.String() != "Unused alias \"AUCTION_PRICE\" for \"PRICE\"\n" {
+		t.Errorf("Invalid lint %q %v", stdout.String(), err)
+	}
+}
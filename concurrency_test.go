@@ -0,0 +1,78 @@
+package macros
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWithDoesNotModifyParent(t *testing.T) {
+	base := New(Filters{"hex": Hex}, Alias("PRICE", "price"), Skip("SKIP"), Expand("WIN", "${PRICE}"))
+	tpl, err := base.Parse("${price:hex} ${SKIP} ${WIN} ${FOO}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := base.With(Filters{"hex": Base64}, Alias("PRICE", "FOO"), Skip("PRICE"), Expand("WIN", "win"), DefaultValue("-"))
+	values := []Value{String("PRICE", "1"), String("FOO", "foo")}
+	for _, r := range []*Replacer{base, New(Filters{"hex": Hex}, Alias("PRICE", "price"), Skip("SKIP"), Expand("WIN", "${PRICE}"))} {
+		if buf, err := r.Replace(nil, "${price:hex} ${SKIP} ${WIN} ${FOO}", values...); err != nil || string(buf) != "31 ${SKIP} 1 foo" {
+			t.Errorf("Invalid parent replacement %q %v", buf, err)
+		}
+	}
+	if buf, err := tpl.Replace(nil, values...); err != nil || string(buf) != "31 ${SKIP} 1 foo" {
+		t.Errorf("Invalid template replacement %q %v", buf, err)
+	}
+	if buf, err := child.Replace(nil, "${PRICE:hex} ${BAR} ${WIN}", values...); err != nil || string(buf) != "${PRICE:hex} - win" {
+		t.Errorf("Invalid child replacement %q %v", buf, err)
+	}
+}
+
+func TestKeyRingIsCopied(t *testing.T) {
+	keys := KeyRing{"k": []byte("a")}
+	tpl := Must("${A:hmacsha1(k):hex}", keys, Filters{"hex": Hex})
+	before, _ := tpl.Replace(nil, String("A", "a"))
+	keys["k"] = []byte("b")
+	if after, _ := tpl.Replace(nil, String("A", "a")); string(before) != string(after) {
+		t.Errorf("Key ring change modified template")
+	}
+}
+
+func TestConcurrentRenderAndWith(t *testing.T) {
+	base := New(Filters{"hex": Hex}, Alias("PRICE", "price"), ArgFilters{"fixed": Fixed})
+	tpl, err := base.Parse("${price:hex} ${*ITEMS}${.}${/ITEMS} ${N:fixed(2)}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []Value{String("PRICE", "1"), List("ITEMS", String("", "a"), String("", "b")), Float64("N", 1.5)}
+	expect := "31 ab 1.50"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if buf, err := tpl.Replace(nil, values...); err != nil || string(buf) != expect {
+					t.Errorf("Invalid replacement %q %v", buf, err)
+					return
+				}
+				buf, release, err := tpl.Render(values...)
+				if err != nil || string(buf) != expect {
+					t.Errorf("Invalid render %q %v", buf, err)
+					return
+				}
+				release()
+				name := "F" + strconv.Itoa(i)
+				child := base.With(Filters{name: Base64, "hex": QueryEscape}, Alias("PRICE", Token(name)), LoopSeparator(","))
+				if buf, err := child.Replace(nil, "${"+name+":"+name+"}", String("PRICE", "1")); err != nil || string(buf) != "MQ==" {
+					t.Errorf("Invalid child replacement %q %v", buf, err)
+					return
+				}
+				if buf, err := base.Replace(nil, "${price:hex}", values...); err != nil || string(buf) != "31" {
+					t.Errorf("Invalid base replacement %q %v", buf, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
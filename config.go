@@ -0,0 +1,390 @@
+package macros
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config is a declarative Replacer configuration.
+// Filters are referenced by name and resolved from a registry when converting to options.
+// Configurations are read from JSON with `LoadConfig` or YAML with `LoadConfigYAML`.
+type Config struct {
+	Delimiters    []string             `json:"delimiters,omitempty"`
+	Alias         map[Token][]Token    `json:"alias,omitempty"`
+	Skip          []Token              `json:"skip,omitempty"`
+	SkipPrefix    []string             `json:"skip_prefix,omitempty"`
+	SkipMatching  []string             `json:"skip_matching,omitempty"`
+	AliasPatterns []AliasPatternConfig `json:"alias_patterns,omitempty"`
+	Expand        map[Token]string     `json:"expand,omitempty"`
+	Default       *string              `json:"default,omitempty"`
+	Filters       []string             `json:"filters,omitempty"`
+	LoopItem      Token                `json:"loop_item,omitempty"`
+	LoopIndex     Token                `json:"loop_index,omitempty"`
+	LoopSeparator string               `json:"loop_separator,omitempty"`
+	Shell         bool                 `json:"shell,omitempty"`
+	pos           map[string]Position
+	src           string
+}
+
+// AliasPatternConfig is the declarative configuration of an `AliasPattern` option
+type AliasPatternConfig struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// DefaultFilters returns a registry of the built-in filters
+func DefaultFilters() Filters {
+	return Filters{
+		"query":     QueryEscape,
+		"hex":       Hex,
+		"base64":    Base64,
+		"base64url": Base64URL,
+		"micros":    Micros,
+		"cents":     Cents,
+		"md5":       MD5,
+		"sha1":      SHA1,
+		"sha256":    SHA256,
+		"fnv32":     FNV32,
+		"fnv64":     FNV64,
+		"crc32":     CRC32,
+	}
+}
+
+// Position is a position in a configuration file
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+// ConfigError is a configuration error
+type ConfigError struct {
+	Source string
+	Pos    Position
+	Field  string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	var w strings.Builder
+	if e.Source != "" {
+		w.WriteString(e.Source)
+		w.WriteByte(':')
+	}
+	if e.Pos.Line > 0 {
+		w.WriteString(e.Pos.String())
+		w.WriteByte(':')
+	}
+	if w.Len() > 0 {
+		w.WriteByte(' ')
+	}
+	if e.Field != "" {
+		w.WriteString(e.Field)
+		w.WriteString(": ")
+	}
+	w.WriteString(e.Err.Error())
+	return w.String()
+}
+
+// LoadConfig reads a JSON configuration from `r`.
+// The `source` name is used in error messages.
+func LoadConfig(source string, r io.Reader) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c := Config{src: source}
+	if err := json.Unmarshal(data, &c); err != nil {
+		var offset int64
+		switch e := err.(type) {
+		case *json.SyntaxError:
+			offset = e.Offset
+		case *json.UnmarshalTypeError:
+			offset = e.Offset
+			err = fmt.Errorf("Invalid %s value", e.Value)
+			return nil, &ConfigError{source, position(data, offset), e.Field, err}
+		}
+		return nil, &ConfigError{source, position(data, offset), "", err}
+	}
+	c.pos = make(map[string]Position)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := scanPositions(dec, data, "", c.pos); err != nil {
+		return nil, &ConfigError{source, position(data, dec.InputOffset()), "", err}
+	}
+	return &c, nil
+}
+
+// LoadOptions reads a JSON configuration from `r` and converts it to options
+func LoadOptions(source string, r io.Reader, registry Filters) ([]Option, error) {
+	c, err := LoadConfig(source, r)
+	if err != nil {
+		return nil, err
+	}
+	return c.Options(registry)
+}
+
+// Options validates the configuration and converts it to Replacer options.
+// Filter names are resolved from `registry`.
+func (c *Config) Options(registry Filters) ([]Option, error) {
+	var options []Option
+	if c.Shell {
+		options = append(options, ShellSyntax())
+	}
+	switch n := len(c.Delimiters); {
+	case n == 0:
+	case n%2 == 0:
+		pairs := make([]DelimiterPair, 0, n/2)
+		for i := 0; i < n; i += 2 {
+			start, end := c.Delimiters[i], c.Delimiters[i+1]
+			if strings.TrimSpace(start) == "" || strings.TrimSpace(end) == "" {
+				return nil, c.error("delimiters", errInvalidDelimiters)
+			}
+			pairs = append(pairs, DelimiterPair{start, end})
+		}
+		options = append(options, DelimiterPairs(pairs...))
+	default:
+		return nil, c.error("delimiters", errInvalidDelimiters)
+	}
+
+	macros := make([]Token, 0, len(c.Alias))
+	for macro := range c.Alias {
+		macros = append(macros, macro)
+	}
+	sortTokens(macros)
+	seen := make(map[Token]Token)
+	for _, macro := range macros {
+		field := "alias." + string(macro)
+		if strings.TrimSpace(string(macro)) == "" {
+			return nil, c.error(field, errors.New("Empty macro"))
+		}
+		aliases := c.Alias[macro]
+		for i, alias := range aliases {
+			field := field + "[" + strconv.Itoa(i) + "]"
+			if strings.TrimSpace(string(alias)) == "" {
+				return nil, c.error(field, errors.New("Empty alias"))
+			}
+			if other, ok := seen[alias]; ok && other != macro {
+				return nil, c.error(field, fmt.Errorf("Alias %q already defined for %q", alias, other))
+			}
+			seen[alias] = macro
+		}
+		options = append(options, Alias(macro, aliases...))
+	}
+
+	for i, token := range c.Skip {
+		if strings.TrimSpace(string(token)) == "" {
+			return nil, c.error("skip["+strconv.Itoa(i)+"]", errors.New("Empty macro"))
+		}
+	}
+	if len(c.Skip) > 0 {
+		options = append(options, Skip(c.Skip...))
+	}
+	for i, prefix := range c.SkipPrefix {
+		if prefix == "" {
+			return nil, c.error("skip_prefix["+strconv.Itoa(i)+"]", errors.New("Empty prefix"))
+		}
+	}
+	if len(c.SkipPrefix) > 0 {
+		options = append(options, SkipPrefix(c.SkipPrefix...))
+	}
+	for i, p := range c.AliasPatterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, c.error("alias_patterns["+strconv.Itoa(i)+"]", err)
+		}
+		options = append(options, AliasPattern(re, p.Replacement))
+	}
+	for i, pattern := range c.SkipMatching {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, c.error("skip_matching["+strconv.Itoa(i)+"]", err)
+		}
+		options = append(options, SkipMatching(re))
+	}
+
+	if len(c.Expand) > 0 {
+		var r Replacer
+		r.applyOptions(options)
+		macros = macros[:0]
+		for macro := range c.Expand {
+			macros = append(macros, macro)
+		}
+		sortTokens(macros)
+		for _, macro := range macros {
+			tpl := c.Expand[macro]
+			if _, err := r.Parse(tpl); err != nil {
+				return nil, c.error("expand."+string(macro), err)
+			}
+			options = append(options, Expand(macro, tpl))
+		}
+	}
+
+	if c.Default != nil {
+		options = append(options, DefaultValue(*c.Default))
+	}
+
+	if len(c.Filters) > 0 {
+		filters := make(Filters, len(c.Filters))
+		for i, name := range c.Filters {
+			filter := registry[name]
+			if filter == nil {
+				return nil, c.error("filters["+strconv.Itoa(i)+"]", &MissingFilterError{name})
+			}
+			filters[name] = filter
+		}
+		options = append(options, filters)
+	}
+
+	if c.LoopItem != "" || c.LoopIndex != "" {
+		options = append(options, LoopMacros(c.LoopItem, c.LoopIndex))
+	}
+	if c.LoopSeparator != "" {
+		options = append(options, LoopSeparator(c.LoopSeparator))
+	}
+	return options, nil
+}
+
+// Config returns the declarative configuration of a Replacer.
+// Options that cannot be declared by name, i.e. `ArgFilters`, `ValueFilters`, `KeyRing`, `Ciphers` and `Normalize`, are an error.
+func (r *Replacer) Config() (Config, error) {
+	var options []string
+	if len(r.argFilters) > 0 {
+		options = append(options, "arg filters")
+	}
+	if len(r.valueFilters) > 0 {
+		options = append(options, "value filters")
+	}
+	if r.normalize != nil {
+		options = append(options, "normalizer")
+	}
+	if len(options) > 0 {
+		return Config{}, fmt.Errorf("Cannot declare %s in a Config", strings.Join(options, ", "))
+	}
+	return r.config(), nil
+}
+
+// config returns the declarative configuration of the Replacer's options that have one
+func (r *Replacer) config() Config {
+	c := Config{
+		LoopItem:      r.item,
+		LoopIndex:     r.index,
+		LoopSeparator: r.sep,
+		Shell:         r.shell,
+	}
+	if (r.start != "" || r.end != "") && !r.shell {
+		for _, pair := range r.DelimiterPairs() {
+			c.Delimiters = append(c.Delimiters, pair.Start, pair.End)
+		}
+	}
+	if len(r.alias) > 0 {
+		c.Alias = make(map[Token][]Token)
+		for alias, macro := range r.alias {
+			c.Alias[macro] = append(c.Alias[macro], alias)
+		}
+		for _, aliases := range c.Alias {
+			sortTokens(aliases)
+		}
+	}
+	if len(r.expand) > 0 {
+		c.Expand = make(map[Token]string, len(r.expand))
+		for macro, tpl := range r.expand {
+			c.Expand[macro] = tpl
+		}
+	}
+	for _, p := range r.aliasPatterns {
+		c.AliasPatterns = append(c.AliasPatterns, AliasPatternConfig{p.re.String(), p.replacement})
+	}
+	for token := range r.skip {
+		c.Skip = append(c.Skip, token)
+	}
+	sortTokens(c.Skip)
+	c.SkipPrefix = append(c.SkipPrefix, r.skipPrefix...)
+	for _, re := range r.skipMatch {
+		c.SkipMatching = append(c.SkipMatching, re.String())
+	}
+	for name := range r.filters {
+		c.Filters = append(c.Filters, name)
+	}
+	sort.Strings(c.Filters)
+	if r.none.typ == typeString {
+		value := r.none.str
+		c.Default = &value
+	}
+	return c
+}
+
+func (c *Config) error(field string, err error) error {
+	return &ConfigError{c.src, c.pos[field], field, err}
+}
+
+func sortTokens(tokens []Token) {
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i] < tokens[j]
+	})
+}
+
+func position(data []byte, offset int64) Position {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[:offset]
+	line := bytes.Count(data, []byte{'\n'}) + 1
+	col := len(data) - bytes.LastIndexByte(data, '\n')
+	return Position{line, col}
+}
+
+// valueOffset skips separators to find the offset of the next JSON value
+func valueOffset(data []byte, offset int64) int64 {
+	for ; offset < int64(len(data)); offset++ {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ':', ',':
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// scanPositions records the positions of all JSON values by path
+func scanPositions(dec *json.Decoder, data []byte, path string, pos map[string]Position) error {
+	pos[path] = position(data, valueOffset(data, dec.InputOffset()))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			field := key.(string)
+			if path != "" {
+				field = path + "." + field
+			}
+			if err := scanPositions(dec, data, field, pos); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := scanPositions(dec, data, path+"["+strconv.Itoa(i)+"]", pos); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	}
+	return err
+}
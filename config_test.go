@@ -0,0 +1,73 @@
+package macros
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadOptions(t *testing.T) {
+	src := `{
+	"delimiters": ["{", "}"],
+	"alias": {"PRICE": ["AUCTION_PRICE", "price"]},
+	"skip": ["PARTNER_ID"],
+	"expand": {"WIN": "{PRICE:hex}"},
+	"default": "-",
+	"filters": ["hex"]
+}`
+	options, err := LoadOptions("partner.json", strings.NewReader(src), DefaultFilters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(options...)
+	buf, err := r.Replace(nil, "{AUCTION_PRICE} {WIN} {PARTNER_ID} {FOO}", String("PRICE", "\x01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "\x01 01 {PARTNER_ID} -" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	c, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Alias["PRICE"]) != 2 || c.Filters[0] != "hex" || *c.Default != "-" {
+		t.Errorf("Invalid config %v", c)
+	}
+}
+
+func TestLoadOptionsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Src    string
+		Expect string
+	}{
+		{`{"filters": ["hex",`, "test.json:1:20: unexpected end of JSON input"},
+		{`{"skip": 42}`, "test.json:1:12: skip: Invalid number value"},
+		{"{\n  \"filters\": [\"hex\", \"foo\"]\n}", "test.json:2:22: filters[1]: Missing macro filter foo"},
+		{"{\n\"delimiters\": [\"{\"]}", "test.json:2:15: delimiters: Invalid delimiters"},
+		{"{\"alias\": {\"A\": [\"X\"], \"B\": [\"X\"]}}", "test.json:1:30: alias.B[0]: Alias \"X\" already defined for \"A\""},
+		{"{\"expand\": {\"A\": \"${B\"}}", "test.json:1:18: expand.A: Unmatched delimiter \"${\" at position 0"},
+	} {
+		_, err := LoadOptions("test.json", strings.NewReader(tc.Src), DefaultFilters())
+		if err == nil {
+			t.Errorf("Expected error for %s", tc.Src)
+		} else if err.Error() != tc.Expect {
+			t.Errorf("Invalid error %q != %q", err, tc.Expect)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Option Option
+		Expect string
+	}{
+		{ArgFilters{"pad": nil}, "Cannot declare arg filters in a Config"},
+		{KeyRing{"k": []byte("secret")}, "Cannot declare arg filters in a Config"},
+		{ValueFilters{"round": nil}, "Cannot declare value filters in a Config"},
+		{Normalize(UpperCase), "Cannot declare normalizer in a Config"},
+	} {
+		if _, err := New(tc.Option).Config(); err == nil || err.Error() != tc.Expect {
+			t.Errorf("Invalid error %v", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package macros
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"maps"
+)
+
+// Ciphers maps key IDs to AEAD ciphers for the `encrypt` and `decrypt` filters,
+// e.g. `${PAYLOAD:encrypt(k1):base64url}`.
+// Any AEAD can be used, e.g. ChaCha20-Poly1305 from `golang.org/x/crypto`.
+// Ciphers replace the ciphers of previous cipher options.
+type Ciphers map[string]cipher.AEAD
+
+func (c Ciphers) apply(r *Replacer) {
+	// Copy the ciphers so that later changes do not affect the Replacer
+	c = maps.Clone(c)
+	ArgFilters{
+		"encrypt": c.Encrypt,
+		"decrypt": c.Decrypt,
+	}.apply(r)
+}
+
+// AESGCM creates an AES-GCM cipher from a 16, 24 or 32 byte key
+func AESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt is a filter encrypting a value with the cipher named by `id`.
+// The output is a random nonce followed by the sealed value.
+func (c Ciphers) Encrypt(dst, value []byte, id string) ([]byte, error) {
+	return c.encrypt(dst, value, id, rand.Reader)
+}
+
+func (c Ciphers) encrypt(dst, value []byte, id string, random io.Reader) ([]byte, error) {
+	aead, ok := c[id]
+	if !ok {
+		return dst, &MissingKeyError{id}
+	}
+	offset := len(dst)
+	dst = growBuffer(dst, aead.NonceSize())
+	nonce := dst[offset:]
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return dst[:offset], err
+	}
+	return aead.Seal(dst, nonce, value, nil), nil
+}
+
+var errInvalidCiphertext = errors.New("Invalid ciphertext")
+
+// Decrypt is a filter decrypting a value produced by `Encrypt` with the cipher named by `id`
+func (c Ciphers) Decrypt(dst, value []byte, id string) ([]byte, error) {
+	aead, ok := c[id]
+	if !ok {
+		return dst, &MissingKeyError{id}
+	}
+	size := aead.NonceSize()
+	if len(value) < size+aead.Overhead() {
+		return dst, errInvalidCiphertext
+	}
+	out, err := aead.Open(dst, value[:size], value[size:], nil)
+	if err != nil {
+		return dst, errInvalidCiphertext
+	}
+	return out, nil
+}
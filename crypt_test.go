@@ -0,0 +1,68 @@
+package macros
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestCiphers(t *testing.T) {
+	aead, err := AESGCM([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Ciphers{"k1": aead}
+	nonce := bytes.Repeat([]byte{1}, aead.NonceSize())
+	buf, err := c.encrypt([]byte("foo="), []byte("bid=42"), "k1", bytes.NewReader(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := aead.Seal(append([]byte("foo="), nonce...), nonce, []byte("bid=42"), nil)
+	if !bytes.Equal(buf, expect) {
+		t.Errorf("Invalid ciphertext %x", buf)
+	}
+	plain, err := c.Decrypt(nil, buf[4:], "k1")
+	if err != nil || string(plain) != "bid=42" {
+		t.Errorf("Invalid decryption %q %v", plain, err)
+	}
+	buf[len(buf)-1] ^= 1
+	if _, err := c.Decrypt(nil, buf[4:], "k1"); err != errInvalidCiphertext {
+		t.Errorf("Invalid error %v", err)
+	}
+	if _, err := c.Decrypt(nil, nonce, "k1"); err != errInvalidCiphertext {
+		t.Errorf("Invalid error %v", err)
+	}
+	if _, err := c.Encrypt(nil, nil, "k2"); err == nil {
+		t.Errorf("Expected missing key error")
+	}
+}
+
+func TestCiphersTemplate(t *testing.T) {
+	aead, err := AESGCM(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Ciphers{"k1": aead}
+	tpl := Must("http://example.org/click?p=${PAYLOAD:encrypt(k1):base64url}", c, DefaultFilters())
+	values := []Value{String("PAYLOAD", "uid=abc&bid=42")}
+	buf, err := tpl.Replace(nil, values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := tpl.EstimateSizeFor(values...); size < len(buf) {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+	p := buf[bytes.IndexByte(buf, '=')+1:]
+	raw, err := base64.URLEncoding.DecodeString(string(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := c.Decrypt(nil, raw, "k1")
+	if err != nil || string(plain) != "uid=abc&bid=42" {
+		t.Errorf("Invalid round trip %q %v", plain, err)
+	}
+	again, _ := tpl.Replace(nil, values...)
+	if bytes.Equal(buf, again) {
+		t.Errorf("Expected random nonces")
+	}
+}
@@ -0,0 +1,121 @@
+package macros
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// MarshalText implements `encoding.TextMarshaler` interface
+func (t *Template) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements `encoding.TextUnmarshaler` interface.
+// The text is parsed using the template's current options.
+func (t *Template) UnmarshalText(data []byte) error {
+	tpl := Template{config: *t.config.clone()}
+	if err := tpl.parse(string(data)); err != nil {
+		return err
+	}
+	*t = tpl
+	return nil
+}
+
+var errInvalidDelimiters = errors.New("Invalid delimiters")
+
+// templateJSON is the JSON representation of a template.
+// Aliases map each alias to its macro and filters are not included.
+type templateJSON struct {
+	Template      string               `json:"template"`
+	Delimiters    []string             `json:"delimiters,omitempty"`
+	Alias         map[Token]Token      `json:"alias,omitempty"`
+	Skip          []Token              `json:"skip,omitempty"`
+	Expand        map[Token]string     `json:"expand,omitempty"`
+	Default       *string              `json:"default,omitempty"`
+	LoopItem      Token                `json:"loop_item,omitempty"`
+	LoopIndex     Token                `json:"loop_index,omitempty"`
+	LoopSep       string               `json:"loop_separator,omitempty"`
+	SkipPrefix    []string             `json:"skip_prefix,omitempty"`
+	SkipMatching  []string             `json:"skip_matching,omitempty"`
+	AliasPatterns []AliasPatternConfig `json:"alias_patterns,omitempty"`
+	Shell         bool                 `json:"shell,omitempty"`
+}
+
+// MarshalJSON implements `json.Marshaler` interface.
+// The JSON object includes the template's options except for filters and normalizers.
+func (t *Template) MarshalJSON() ([]byte, error) {
+	c := t.config.config()
+	v := templateJSON{
+		Template:      t.String(),
+		Delimiters:    c.Delimiters,
+		Skip:          c.Skip,
+		Expand:        c.Expand,
+		Default:       c.Default,
+		LoopItem:      c.LoopItem,
+		LoopIndex:     c.LoopIndex,
+		LoopSep:       c.LoopSeparator,
+		SkipPrefix:    c.SkipPrefix,
+		SkipMatching:  c.SkipMatching,
+		AliasPatterns: c.AliasPatterns,
+		Shell:         c.Shell,
+	}
+	if len(t.config.alias) > 0 {
+		v.Alias = t.config.alias
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements `json.Unmarshaler` interface.
+// Filters are not serialized so the template keeps its current filters.
+func (t *Template) UnmarshalJSON(data []byte) error {
+	var v templateJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	c := Config{
+		Delimiters:    v.Delimiters,
+		Skip:          v.Skip,
+		Expand:        v.Expand,
+		Default:       v.Default,
+		LoopItem:      v.LoopItem,
+		LoopIndex:     v.LoopIndex,
+		LoopSeparator: v.LoopSep,
+		SkipPrefix:    v.SkipPrefix,
+		SkipMatching:  v.SkipMatching,
+		AliasPatterns: v.AliasPatterns,
+		Shell:         v.Shell,
+	}
+	if len(v.Alias) > 0 {
+		c.Alias = make(map[Token][]Token)
+		for alias, macro := range v.Alias {
+			c.Alias[macro] = append(c.Alias[macro], alias)
+		}
+		for _, aliases := range c.Alias {
+			sortTokens(aliases)
+		}
+	}
+	options, err := c.Options(nil)
+	if err != nil {
+		return err
+	}
+	tpl := Template{}
+	t.config.filters.apply(&tpl.config)
+	t.config.argFilters.apply(&tpl.config)
+	t.config.valueFilters.apply(&tpl.config)
+	tpl.config.applyOptions(options)
+	if err := tpl.parse(v.Template); err != nil {
+		return err
+	}
+	*t = tpl
+	return nil
+}
+
+// GobEncode implements `gob.GobEncoder` interface
+func (t *Template) GobEncode() ([]byte, error) {
+	return t.MarshalJSON()
+}
+
+// GobDecode implements `gob.GobDecoder` interface
+func (t *Template) GobDecode(data []byte) error {
+	return t.UnmarshalJSON(data)
+}
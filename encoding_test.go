@@ -0,0 +1,80 @@
+package macros
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+func TestTemplateText(t *testing.T) {
+	tpl := Must("foo ${BAR} ${?BAZ}baz${/BAZ}")
+	data, err := tpl.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var other Template
+	if err := other.UnmarshalText(data); err != nil {
+		t.Fatal(err)
+	}
+	if s := other.String(); s != tpl.String() {
+		t.Errorf("Invalid template %q", s)
+	}
+	if err := other.UnmarshalText([]byte("${FOO")); err == nil {
+		t.Errorf("Expected parse error")
+	}
+}
+
+func TestTemplateJSON(t *testing.T) {
+	tpl := Must("{{FOO:hex}} {{Bar}} {{BAZ}} {{QUX}}",
+		Delimiters("{{", "}}"),
+		Alias("BAR", "Bar"),
+		Skip("QUX"),
+		Expand("BAZ", "{{FOO}}-{{BAR}}"),
+		DefaultValue("none"),
+		Filters{"hex": Hex},
+	)
+	data, err := json.Marshal(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"template":"{{FOO:hex}} {{BAR}} {{BAZ}} {{QUX}}","delimiters":["{{","}}"],"alias":{"Bar":"BAR"},"skip":["QUX"],"expand":{"BAZ":"{{FOO}}-{{BAR}}"},"default":"none"}`
+	if string(data) != expect {
+		t.Errorf("Invalid JSON %s", data)
+	}
+	other := Must("", Filters{"hex": Hex})
+	if err := json.Unmarshal(data, other); err != nil {
+		t.Fatal(err)
+	}
+	values := []Value{String("FOO", "\x00"), String("Bar", "bar")}
+	want, err := tpl.Replace(nil, values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := other.Replace(nil, values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) || string(got) != "00 none \x00-none {{QUX}}" {
+		t.Errorf("Invalid replacement %q != %q", got, want)
+	}
+}
+
+func TestTemplateGob(t *testing.T) {
+	tpl := Must("%FOO% %bar%", Delimiters("%", "%"), Alias("BAR", "bar"))
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tpl); err != nil {
+		t.Fatal(err)
+	}
+	var other Template
+	if err := gob.NewDecoder(&buf).Decode(&other); err != nil {
+		t.Fatal(err)
+	}
+	got, err := other.Replace(nil, String("FOO", "foo"), String("BAR", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "foo bar" {
+		t.Errorf("Invalid replacement %q", got)
+	}
+}
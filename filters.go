@@ -3,7 +3,6 @@ package macros
 import (
 	"encoding/base64"
 	"encoding/hex"
-	"net/url"
 )
 
 // Filter is a converter for values
@@ -17,28 +16,99 @@ func (filters Filters) apply(r *Replacer) {
 		return
 	}
 
-	if r.filters == nil {
-		r.filters = Filters{}
-	}
+	r.filters = writable(r, r.filters, ownFilters)
 	for name, filter := range filters {
 		r.filters[name] = filter
 	}
 }
 
+// ArgFilter is a converter for values that accepts an argument, e.g. `${PRICE:fixed(4)}`
+type ArgFilter func(dst, value []byte, arg string) ([]byte, error)
+
+// ArgFilters maps names to filters with arguments
+type ArgFilters map[string]ArgFilter
+
+func (filters ArgFilters) apply(r *Replacer) {
+	if len(filters) == 0 {
+		return
+	}
+
+	r.argFilters = writable(r, r.argFilters, ownArgFilters)
+	for name, filter := range filters {
+		r.argFilters[name] = filter
+	}
+}
+
+// ValueFilter is a converter for typed values that is applied before the value is formatted.
+// It receives the original value, e.g. a number or a time, and an optional argument.
+// Value filters following byte filters receive the formatted value as a string value.
+type ValueFilter func(v Value, arg string) (Value, error)
+
+// ValueFilters maps names to value filters
+type ValueFilters map[string]ValueFilter
+
+func (filters ValueFilters) apply(r *Replacer) {
+	if len(filters) == 0 {
+		return
+	}
+
+	r.valueFilters = writable(r, r.valueFilters, ownValueFilters)
+	for name, filter := range filters {
+		r.valueFilters[name] = filter
+	}
+}
+
+var defaultValueFilters = ValueFilters{
+	"tz":          TZ,
+	"utc":         UTC,
+	"format":      Format,
+	"rfc3339":     RFC3339,
+	"rfc3339nano": RFC3339Nano,
+	"unix":        UnixTime,
+	"unixms":      UnixMilli,
+	"unixnano":    UnixNano,
+	"add":         Add,
+	"sub":         Sub,
+	"mul":         Mul,
+	"div":         Div,
+}
+
+// DefaultValueFilters returns a registry of the built-in value filters.
+func DefaultValueFilters() ValueFilters {
+	filters := make(ValueFilters, len(defaultValueFilters))
+	for name, filter := range defaultValueFilters {
+		filters[name] = filter
+	}
+	return filters
+}
+
 // QueryEscape is a filter escaping a value for URL query strings
 func QueryEscape(dst, value []byte) ([]byte, error) {
-	q := url.QueryEscape(string(value))
-	return append(dst, q...), nil
+	const hexDigits = "0123456789ABCDEF"
+	for _, c := range value {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+			dst = append(dst, c)
+		case c == '-', c == '_', c == '.', c == '~':
+			dst = append(dst, c)
+		case c == ' ':
+			dst = append(dst, '+')
+		default:
+			dst = append(dst, '%', hexDigits[c>>4], hexDigits[c&15])
+		}
+	}
+	return dst, nil
 }
 
 // Base64 is a filter converting a value to base64 string
 func Base64(buf, value []byte) ([]byte, error) {
 	size := base64.StdEncoding.EncodedLen(len(value))
 	offset := len(buf)
-	buf = append(buf, make([]byte, size)...)
+	buf = growBuffer(buf, size)
 	base64.StdEncoding.Encode(buf[offset:], value)
 	return buf, nil
 }
+
 func growBuffer(buf []byte, size int) []byte {
 	return append(buf, make([]byte, size)...)
 }
@@ -3,6 +3,7 @@ package macros
 import (
 	"encoding/base64"
 	"encoding/hex"
+	"net/url"
 	"testing"
 )
 
@@ -66,3 +67,14 @@ func TestFilters(t *testing.T) {
 		t.Errorf("Invalid filter replacement %q", buf)
 	}
 }
+
+func TestQueryEscapeCompat(t *testing.T) {
+	v := "a b&c=d/é~_.-+%\x00"
+	data, err := QueryEscape(nil, []byte(v))
+	if err != nil {
+		t.Error(err)
+	}
+	if expect := url.QueryEscape(v); string(data) != expect {
+		t.Errorf("Invalid filter %q != %q", data, expect)
+	}
+}
@@ -0,0 +1,418 @@
+package macros
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GenFunc describes a typed render function to generate from a template
+type GenFunc struct {
+	// Name is the name of the generated function
+	Name string
+	// Template is the template to render
+	Template *Template
+	// Params are the typed function parameters in order
+	Params []GenParam
+	// Filters are Go expressions for non built-in filters by name
+	Filters map[string]string
+	// Imports are the import paths required by filter expressions
+	Imports []string
+}
+
+// GenParam is a typed parameter of a generated function
+type GenParam struct {
+	Macro Token
+	// Type is the Go type of the parameter.
+	// Supported types are string, []byte, bool, all integer and float types and slices of them for loop sections.
+	Type string
+	// Name is the Go name of the parameter, it defaults to the camel case macro name
+	Name string
+}
+
+type genFilter struct {
+	expr     string
+	fallible bool
+}
+
+var builtinFilters = map[uintptr]genFilter{
+	reflect.ValueOf(QueryEscape).Pointer(): {"macros.QueryEscape", false},
+	reflect.ValueOf(Hex).Pointer():         {"macros.Hex", false},
+	reflect.ValueOf(Base64).Pointer():      {"macros.Base64", false},
+	reflect.ValueOf(Base64URL).Pointer():   {"macros.Base64URL", false},
+	reflect.ValueOf(MD5).Pointer():         {"macros.MD5", false},
+	reflect.ValueOf(SHA1).Pointer():        {"macros.SHA1", false},
+	reflect.ValueOf(SHA256).Pointer():      {"macros.SHA256", false},
+	reflect.ValueOf(FNV32).Pointer():       {"macros.FNV32", false},
+	reflect.ValueOf(FNV64).Pointer():       {"macros.FNV64", false},
+	reflect.ValueOf(CRC32).Pointer():       {"macros.CRC32", false},
+	reflect.ValueOf(Micros).Pointer():      {"macros.Micros", true},
+	reflect.ValueOf(Cents).Pointer():       {"macros.Cents", true},
+	reflect.ValueOf(Fixed).Pointer():       {"macros.Fixed", true},
+	reflect.ValueOf(Exp).Pointer():         {"macros.Exp", true},
+}
+
+// Generate writes the Go source of package `pkg` with typed render functions.
+// Functions append to a buffer without any per-token lookup.
+// Functions using only built-in filters return `[]byte`, otherwise they return `([]byte, error)`.
+func Generate(w io.Writer, pkg string, funcs ...GenFunc) error {
+	var body bytes.Buffer
+	imports := make(map[string]bool)
+	for i := range funcs {
+		g := generator{
+			fn:      &funcs[i],
+			r:       &funcs[i].Template.config,
+			imports: imports,
+		}
+		if err := g.generate(); err != nil {
+			return fmt.Errorf("Generate %s failed: %s", funcs[i].Name, err)
+		}
+		body.Write(g.buf.Bytes())
+	}
+	var src bytes.Buffer
+	src.WriteString("// Code generated by macros. DO NOT EDIT.\n\n")
+	src.WriteString("package " + pkg + "\n\n")
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for path := range imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		src.WriteString("import (\n")
+		for _, path := range paths {
+			src.WriteString(strconv.Quote(path) + "\n")
+		}
+		src.WriteString(")\n\n")
+	}
+	src.Write(body.Bytes())
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+type genVar struct {
+	expr string
+	typ  string
+}
+
+type generator struct {
+	fn        *GenFunc
+	r         *Replacer
+	buf       bytes.Buffer
+	imports   map[string]bool
+	scope     []map[Token]genVar
+	expanding []Token
+	fallible  bool
+	n         int
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate() error {
+	fn := g.fn
+	for _, path := range fn.Imports {
+		g.imports[path] = true
+	}
+	params := make(map[Token]genVar, len(fn.Params))
+	args := make([]string, 0, len(fn.Params)+1)
+	args = append(args, "buf []byte")
+	for i, p := range fn.Params {
+		macro, _ := g.r.Alias(p.Macro).split()
+		name := p.Name
+		if name == "" {
+			name = goIdent(string(p.Macro), i)
+		}
+		if _, err := appendExpr(p.Type, name); err != nil {
+			// Slices are allowed for loop sections
+			if _, err := appendExpr(strings.TrimPrefix(p.Type, "[]"), name); err != nil {
+				return err
+			}
+		}
+		params[macro] = genVar{name, p.Type}
+		args = append(args, name+" "+p.Type)
+	}
+	g.scope = append(g.scope, params)
+
+	var body bytes.Buffer
+	g.buf, body = body, g.buf
+	if err := g.chunks(fn.Template.chunks, fn.Template.tail); err != nil {
+		return err
+	}
+	g.buf, body = body, g.buf
+
+	src := strconv.Quote(fn.Template.String())
+	g.printf("// %s renders the template %s\n", fn.Name, strings.Replace(src, "\n", "\\n", -1))
+	if g.fallible {
+		g.printf("func %s(%s) ([]byte, error) {\n", fn.Name, strings.Join(args, ", "))
+		g.printf("var err error\noriginal := buf\n")
+	} else {
+		g.printf("func %s(%s) []byte {\n", fn.Name, strings.Join(args, ", "))
+	}
+	g.buf.Write(body.Bytes())
+	if g.fallible {
+		g.printf("return buf, nil\n}\n\n")
+	} else {
+		g.printf("return buf\n}\n\n")
+	}
+	return nil
+}
+
+func (g *generator) lookup(macro Token) (genVar, bool) {
+	for i := len(g.scope) - 1; i >= 0; i-- {
+		if v, ok := g.scope[i][macro]; ok {
+			return v, true
+		}
+	}
+	return genVar{}, false
+}
+
+func (g *generator) literal(s string) {
+	if s != "" {
+		g.printf("buf = append(buf, %s...)\n", strconv.Quote(s))
+	}
+}
+
+func (g *generator) chunks(chunks []chunk, tail string) error {
+	for i := range chunks {
+		chunk := &chunks[i]
+		g.literal(chunk.prefix)
+		var err error
+		if s := chunk.section; s != nil {
+			err = g.section(chunk.token, s)
+		} else if chunk.raw != "" && g.r.skipped(chunk.token) {
+			g.literal(chunk.raw)
+		} else {
+			err = g.token(chunk.token)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	g.literal(tail)
+	return nil
+}
+
+func (g *generator) section(macro Token, s *section) error {
+	if _, ok := g.r.expand[macro]; ok {
+		return fmt.Errorf("Expanded macro %q cannot be used in a section", macro)
+	}
+	v, ok := g.lookup(macro)
+	if s.kind == SectionEach {
+		if !ok {
+			return nil
+		}
+		g.n++
+		item, index := g.r.LoopMacros()
+		i, x := "i"+strconv.Itoa(g.n), "x"+strconv.Itoa(g.n)
+		elem := strings.TrimPrefix(v.typ, "[]")
+		if elem == v.typ || v.typ == "[]byte" {
+			g.printf("{\n%s, %s := 0, %s\n", i, x, v.expr)
+			elem = v.typ
+		} else {
+			g.printf("for %s, %s := range %s {\n", i, x, v.expr)
+			if g.r.sep != "" {
+				g.printf("if %s > 0 {\n", i)
+				g.literal(g.r.sep)
+				g.printf("}\n")
+			}
+		}
+		g.printf("_, _ = %s, %s\n", i, x)
+		g.scope = append(g.scope, map[Token]genVar{
+			item:  {x, elem},
+			index: {i, "int"},
+		})
+		defer func() { g.scope = g.scope[:len(g.scope)-1] }()
+		if err := g.chunks(s.chunks, s.tail); err != nil {
+			return err
+		}
+		g.printf("}\n")
+		return nil
+	}
+	cond := "false"
+	if ok {
+		switch {
+		case v.typ == "string" || strings.HasPrefix(v.typ, "[]"):
+			cond = "len(" + v.expr + ") > 0"
+		default:
+			cond = "true"
+		}
+	}
+	if s.kind == SectionNot {
+		cond = "!(" + cond + ")"
+	}
+	g.printf("if %s {\n", cond)
+	if err := g.chunks(s.chunks, s.tail); err != nil {
+		return err
+	}
+	g.printf("}\n")
+	return nil
+}
+
+func (g *generator) token(token Token) error {
+	macro, filters := token.split()
+	if alias, ok := g.r.alias[macro]; ok {
+		macro = alias
+	}
+	if g.r.skipped(macro) {
+		g.literal(string(g.r.appendToken(nil, macro, filters)))
+		return nil
+	}
+	if op, _ := shellOp(filters); g.r.shell && op != 0 {
+		return fmt.Errorf("Shell syntax in %q is not supported", token)
+	}
+	if filters != "" {
+		g.n++
+		g.printf("{\nn%d := len(buf)\n", g.n)
+	}
+	n := g.n
+	if exp, ok := g.r.expand[macro]; ok {
+		for _, m := range g.expanding {
+			if m == macro {
+				return fmt.Errorf("Recursive expansion of %q", macro)
+			}
+		}
+		tpl, err := g.r.Parse(exp)
+		if err != nil {
+			return fmt.Errorf("Expand %q failed: %s", macro, err)
+		}
+		g.expanding = append(g.expanding, macro)
+		err = g.chunks(tpl.chunks, tpl.tail)
+		g.expanding = g.expanding[:len(g.expanding)-1]
+		if err != nil {
+			return err
+		}
+	} else if v, ok := g.lookup(macro); ok {
+		expr, err := appendExpr(v.typ, v.expr)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(expr, "strconv.") {
+			g.imports["strconv"] = true
+		}
+		g.printf("buf = %s\n", expr)
+	} else if g.r.none.typ == typeString {
+		g.literal(g.r.none.str)
+	} else {
+		return fmt.Errorf("Macro %q has no parameter", macro)
+	}
+	if filters == "" {
+		return nil
+	}
+	for len(filters) > 1 {
+		var filter Token
+		filter, filters = splitFilter(filters[1:])
+		f, err := g.filter(filter)
+		if err != nil {
+			return err
+		}
+		args := fmt.Sprintf("buf, buf[n%d:m%d]", n, n)
+		if _, arg, ok := filterArg(filter); ok {
+			args += ", " + strconv.Quote(arg)
+		}
+		g.printf("{\nm%d := len(buf)\n", n)
+		if f.fallible {
+			g.fallible = true
+			g.printf("if buf, err = %s(%s); err != nil {\nreturn original, err\n}\n", f.expr, args)
+		} else {
+			g.printf("buf, _ = %s(%s)\n", f.expr, args)
+		}
+		g.printf("buf = append(buf[:n%d], buf[m%d:]...)\n}\n", n, n)
+	}
+	g.printf("}\n")
+	return nil
+}
+
+func (g *generator) filter(filter Token) (genFilter, error) {
+	name, _, hasArg := filterArg(filter)
+	if expr, ok := g.fn.Filters[name]; ok {
+		return genFilter{expr, true}, nil
+	}
+	var fn interface{}
+	if hasArg {
+		if f := g.r.argFilter(name); f != nil {
+			fn = f
+		}
+	} else if f := g.r.filter(name); f != nil {
+		fn = f
+	}
+	if fn == nil {
+		if g.r.valueFilter(name) != nil {
+			return genFilter{}, fmt.Errorf("Value filter %q is not supported", name)
+		}
+		return genFilter{}, &MissingFilterError{name}
+	}
+	if f, ok := builtinFilters[reflect.ValueOf(fn).Pointer()]; ok {
+		g.imports["github.com/alxarch/macros"] = true
+		return f, nil
+	}
+	return genFilter{}, fmt.Errorf("No Go expression for filter %q", name)
+}
+
+// appendExpr returns a Go expression appending `x` of type `typ` to buf
+func appendExpr(typ, x string) (string, error) {
+	switch typ {
+	case "string", "[]byte":
+		return "append(buf, " + x + "...)", nil
+	case "bool":
+		return "strconv.AppendBool(buf, " + x + ")", nil
+	case "int", "int8", "int16", "int32":
+		return "strconv.AppendInt(buf, int64(" + x + "), 10)", nil
+	case "int64":
+		return "strconv.AppendInt(buf, " + x + ", 10)", nil
+	case "uint", "uint8", "uint16", "uint32":
+		return "strconv.AppendUint(buf, uint64(" + x + "), 10)", nil
+	case "uint64":
+		return "strconv.AppendUint(buf, " + x + ", 10)", nil
+	case "float32":
+		return "strconv.AppendFloat(buf, float64(" + x + "), 'f', -1, 32)", nil
+	case "float64":
+		return "strconv.AppendFloat(buf, " + x + ", 'f', -1, 64)", nil
+	default:
+		return "", fmt.Errorf("Unsupported parameter type %q", typ)
+	}
+}
+
+// goIdent converts a macro name to a camel case Go identifier, names without letters or digits use the param index
+func goIdent(macro string, index int) string {
+	parts := strings.FieldsFunc(macro, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var w strings.Builder
+	for i, part := range parts {
+		part = strings.ToLower(part)
+		if i > 0 {
+			part = upperFirst(part)
+		}
+		w.WriteString(part)
+	}
+	name := w.String()
+	if name == "" {
+		return "p" + strconv.Itoa(index)
+	}
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsLetter(r) || token.IsKeyword(name) {
+		name = "p" + upperFirst(name)
+	}
+	switch name {
+	case "buf", "err", "original", "macros", "strconv":
+		name += "_"
+	}
+	return name
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
@@ -0,0 +1,100 @@
+package macros
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tpl := Must("/win?price=${PRICE}&id=${ID:hex}${?GDPR}&gdpr=${GDPR}${/GDPR}&x=${X}",
+		Alias("PRICE", "price"),
+		Filters{"hex": Hex},
+		Skip("X"),
+	)
+	var buf bytes.Buffer
+	err := Generate(&buf, "win", GenFunc{
+		Name:     "RenderWinURL",
+		Template: tpl,
+		Params: []GenParam{
+			{Macro: "price", Type: "float64"},
+			{Macro: "ID", Type: "string"},
+			{Macro: "GDPR", Type: "bool"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `// Code generated by macros. DO NOT EDIT.
+
+package win
+
+import (
+	"github.com/alxarch/macros"
+	"strconv"
+)
+
+// RenderWinURL renders the template "/win?price=${PRICE}&id=${ID:hex}${?GDPR}&gdpr=${GDPR}${/GDPR}&x=${X}"
+func RenderWinURL(buf []byte, price float64, id string, gdpr bool) []byte {
+	buf = append(buf, "/win?price="...)
+	buf = strconv.AppendFloat(buf, price, 'f', -1, 64)
+	buf = append(buf, "&id="...)
+	{
+		n1 := len(buf)
+		buf = append(buf, id...)
+		{
+			m1 := len(buf)
+			buf, _ = macros.Hex(buf, buf[n1:m1])
+			buf = append(buf[:n1], buf[m1:]...)
+		}
+	}
+	if true {
+		buf = append(buf, "&gdpr="...)
+		buf = strconv.AppendBool(buf, gdpr)
+	}
+	buf = append(buf, "&x="...)
+	buf = append(buf, "${X}"...)
+	return buf
+}
+`
+	if buf.String() != expect {
+		t.Errorf("Invalid generated code\n%s", buf.String())
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, fn := range []GenFunc{
+		{Name: "F", Template: Must("${FOO}")},
+		{Name: "F", Template: Must("${FOO}"), Params: []GenParam{{Macro: "FOO", Type: "time.Time"}}},
+		{Name: "F", Template: Must("${FOO:hex}"), Params: []GenParam{{Macro: "FOO", Type: "string"}}},
+		{Name: "F", Template: Must("${FOO:add(1)}"), Params: []GenParam{{Macro: "FOO", Type: "int"}}},
+		{Name: "F", Template: Must("${FOO:hex}", Filters{"hex": func(b, v []byte) ([]byte, error) { return b, nil }}), Params: []GenParam{{Macro: "FOO", Type: "string"}}},
+	} {
+		var buf bytes.Buffer
+		if err := Generate(&buf, "foo", fn); err == nil {
+			t.Errorf("Expected error for %s", fn.Template)
+		}
+	}
+}
+
+func TestGoIdent(t *testing.T) {
+	for macro, expect := range map[string]string{
+		"AUCTION_PRICE": "auctionPrice",
+		"_":             "p2",
+		"1st":           "p1st",
+		"type":          "pType",
+		"ärger-öl":      "ärgerÖl",
+		"buf":           "buf_",
+	} {
+		if name := goIdent(macro, 2); name != expect {
+			t.Errorf("Invalid identifier for %q: %q != %q", macro, name, expect)
+		}
+	}
+	var buf bytes.Buffer
+	fn := GenFunc{Name: "F", Template: Must("${_}${-}"), Params: []GenParam{{Macro: "_", Type: "string"}, {Macro: "-", Type: "string"}}}
+	if err := Generate(&buf, "foo", fn); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("func F(buf []byte, p0 string, p1 string)")) {
+		t.Errorf("Invalid generated code %s", buf.Bytes())
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/alxarch/macros
+
+go 1.21
@@ -0,0 +1,143 @@
+package macros
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"maps"
+	"strings"
+)
+
+// MD5 is a filter converting a value to its raw MD5 digest, e.g. `${ID:md5:hex}`
+func MD5(dst, value []byte) ([]byte, error) {
+	sum := md5.Sum(value)
+	return append(dst, sum[:]...), nil
+}
+
+// SHA1 is a filter converting a value to its raw SHA-1 digest
+func SHA1(dst, value []byte) ([]byte, error) {
+	sum := sha1.Sum(value)
+	return append(dst, sum[:]...), nil
+}
+
+// SHA256 is a filter converting a value to its raw SHA-256 digest
+func SHA256(dst, value []byte) ([]byte, error) {
+	sum := sha256.Sum256(value)
+	return append(dst, sum[:]...), nil
+}
+
+// FNV32 is a filter converting a value to its 32-bit FNV-1a hash in big endian byte order
+func FNV32(dst, value []byte) ([]byte, error) {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for _, c := range value {
+		h ^= uint32(c)
+		h *= prime32
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], h)
+	return append(dst, buf[:]...), nil
+}
+
+// FNV64 is a filter converting a value to its 64-bit FNV-1a hash in big endian byte order
+func FNV64(dst, value []byte) ([]byte, error) {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for _, c := range value {
+		h ^= uint64(c)
+		h *= prime64
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], h)
+	return append(dst, buf[:]...), nil
+}
+
+// CRC32 is a filter converting a value to its IEEE CRC-32 checksum in big endian byte order
+func CRC32(dst, value []byte) ([]byte, error) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], crc32.ChecksumIEEE(value))
+	return append(dst, buf[:]...), nil
+}
+
+// KeyRing maps names to secret keys for keyed filters so that secrets never appear in templates.
+// As an option it registers the `hmacmd5`, `hmacsha1` and `hmacsha256` filters,
+// e.g. `sig=${PAYLOAD:hmacsha256(key1):hex}`. A key ring replaces the keys of previous key ring options.
+type KeyRing map[string][]byte
+
+func (keys KeyRing) apply(r *Replacer) {
+	// Copy the keys so that later changes do not affect the Replacer
+	keys = maps.Clone(keys)
+	ArgFilters{
+		"hmacmd5":    keys.HMAC(md5.New),
+		"hmacsha1":   keys.HMAC(sha1.New),
+		"hmacsha256": keys.HMAC(sha256.New),
+	}.apply(r)
+}
+
+// HMAC creates a filter converting a value to its raw HMAC digest using the key named by the filter argument
+func (keys KeyRing) HMAC(h func() hash.Hash) ArgFilter {
+	return func(dst, value []byte, name string) ([]byte, error) {
+		key, ok := keys[name]
+		if !ok {
+			return dst, &MissingKeyError{name}
+		}
+		mac := hmac.New(h, key)
+		mac.Write(value)
+		return mac.Sum(dst), nil
+	}
+}
+
+// MissingKeyError is an error for keys missing from a key ring
+type MissingKeyError struct {
+	key string
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("Missing key %q", e.key)
+}
+
+// SignURL appends `url` to `dst` adding its hex encoded HMAC-SHA256 signature as query parameter `param`
+func SignURL(dst []byte, url, param string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(url))
+	dst = append(dst, url...)
+	if strings.IndexByte(url, '?') == -1 {
+		dst = append(dst, '?')
+	} else {
+		dst = append(dst, '&')
+	}
+	dst = append(dst, param...)
+	dst = append(dst, '=')
+	var sum [sha256.Size]byte
+	offset := len(dst)
+	dst = growBuffer(dst, hex.EncodedLen(sha256.Size))
+	hex.Encode(dst[offset:], mac.Sum(sum[:0]))
+	return dst
+}
+
+// VerifyURL checks that the last query parameter of `url` is a valid signature added by `SignURL`
+func VerifyURL(url, param string, key []byte) bool {
+	i := strings.LastIndex(url, param+"=")
+	if i < 1 || url[i-1] != '?' && url[i-1] != '&' {
+		return false
+	}
+	sig, err := hex.DecodeString(url[i+len(param)+1:])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(url[:i-1]))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,76 @@
+package macros
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"testing"
+)
+
+func TestHashFilters(t *testing.T) {
+	value := []byte("foo bar")
+	for name, h := range map[string]hash.Hash{
+		"md5":    md5.New(),
+		"sha1":   sha1.New(),
+		"sha256": sha256.New(),
+		"fnv32":  fnv.New32a(),
+		"fnv64":  fnv.New64a(),
+		"crc32":  crc32.NewIEEE(),
+	} {
+		h.Write(value)
+		expect := hex.EncodeToString(h.Sum(nil))
+		tpl := Must("${FOO:"+name+":hex}", DefaultFilters())
+		buf, err := tpl.Replace(nil, String("FOO", string(value)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != expect {
+			t.Errorf("Invalid %s %q", name, buf)
+		}
+		if size := tpl.EstimateSizeFor(String("FOO", "")); size < len(expect) {
+			t.Errorf("Invalid %s size estimation %d", name, size)
+		}
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	keys := KeyRing{"key1": []byte("secret")}
+	tpl := Must("sig=${PAYLOAD:hmacsha256(key1):hex}", keys, DefaultFilters())
+	buf, err := tpl.Replace(nil, String("PAYLOAD", "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("foo"))
+	if expect := "sig=" + hex.EncodeToString(mac.Sum(nil)); string(buf) != expect {
+		t.Errorf("Invalid signature %q", buf)
+	}
+	if size := tpl.EstimateSizeFor(String("PAYLOAD", "")); size < len(buf) {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+	_, err = Must("${PAYLOAD:hmacsha1(key2)}", keys).Replace(nil, String("PAYLOAD", "foo"))
+	if _, ok := err.(*MissingKeyError); !ok {
+		t.Errorf("Invalid error %v", err)
+	}
+}
+
+func TestSignURL(t *testing.T) {
+	key := []byte("secret")
+	for _, u := range []string{"http://example.org/win", "http://example.org/win?id=42"} {
+		signed := string(SignURL(nil, u, "sig", key))
+		if !VerifyURL(signed, "sig", key) {
+			t.Errorf("Invalid signed URL %q", signed)
+		}
+		if VerifyURL(signed, "sig", []byte("foo")) {
+			t.Errorf("Signature verified with wrong key %q", signed)
+		}
+		if VerifyURL(u+"&sig=00", "sig", key) {
+			t.Errorf("Invalid signature verified %q", u)
+		}
+	}
+}
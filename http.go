@@ -0,0 +1,131 @@
+package macros
+
+import (
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Request macros
+const (
+	MacroRemoteIP    Token = "REMOTE_IP"
+	MacroUserAgent   Token = "USER_AGENT"
+	MacroReferer     Token = "REFERER"
+	MacroHost        Token = "HOST"
+	MacroMethod      Token = "METHOD"
+	MacroPath        Token = "PATH"
+	MacroRequestTime Token = "REQUEST_TIME"
+)
+
+// Request macro prefixes
+const (
+	QueryPrefix  = "query."
+	HeaderPrefix = "header."
+	CookiePrefix = "cookie."
+)
+
+// Request creates a new value that replaces macros with data from an HTTP request.
+// Query parameters, headers and cookies are available with the `query.`, `header.` and `cookie.` prefixes.
+// Multiple query or header values are joined with commas and can be used in loop sections.
+// The request time is the time the value was created formatted as RFC3339.
+func Request(r *http.Request) Value {
+	return FromSource(newRequestSource(r, false))
+}
+
+// newRequestSource parses the query up front so that lookups do not modify the source
+func newRequestSource(r *http.Request, escape bool) *requestSource {
+	return &requestSource{
+		req:    r,
+		query:  r.URL.Query(),
+		now:    time.Now(),
+		escape: escape,
+	}
+}
+
+type requestSource struct {
+	req    *http.Request
+	query  url.Values
+	now    time.Time
+	escape bool // query escape request data
+}
+
+func (s *requestSource) Lookup(macro Token) (Value, bool) {
+	r := s.req
+	switch name := string(macro); {
+	case strings.HasPrefix(name, QueryPrefix):
+		if values, ok := s.query[name[len(QueryPrefix):]]; ok {
+			return s.concat(macro, values), true
+		}
+	case strings.HasPrefix(name, HeaderPrefix):
+		key := textproto.CanonicalMIMEHeaderKey(name[len(HeaderPrefix):])
+		if values, ok := r.Header[key]; ok {
+			return s.concat(macro, values), true
+		}
+	case strings.HasPrefix(name, CookiePrefix):
+		if c, err := r.Cookie(name[len(CookiePrefix):]); err == nil {
+			return s.string(macro, c.Value), true
+		}
+	case macro == MacroRemoteIP:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return s.string(macro, host), true
+	case macro == MacroUserAgent:
+		return s.string(macro, r.UserAgent()), true
+	case macro == MacroReferer:
+		return s.string(macro, r.Referer()), true
+	case macro == MacroHost:
+		return s.string(macro, r.Host), true
+	case macro == MacroMethod:
+		return s.string(macro, r.Method), true
+	case macro == MacroPath:
+		return s.string(macro, r.URL.Path), true
+	case macro == MacroRequestTime:
+		if s.escape {
+			// Time zone offsets contain a `+` that is a space in query strings
+			return Time(macro, s.now.UTC(), time.RFC3339), true
+		}
+		return Time(macro, s.now, time.RFC3339), true
+	}
+	return Value{}, false
+}
+
+func (s *requestSource) string(macro Token, v string) Value {
+	if s.escape {
+		v = url.QueryEscape(v)
+	}
+	return String(macro, v)
+}
+
+func (s *requestSource) concat(macro Token, values []string) Value {
+	if s.escape {
+		escaped := make([]string, len(values))
+		for i, v := range values {
+			escaped[i] = url.QueryEscape(v)
+		}
+		values = escaped
+	}
+	return Concat(macro, ",", values)
+}
+
+// RedirectHandler creates a handler that redirects to the URL rendered from `tpl` using request data and `values`.
+// Request data is query escaped so that it cannot change the URL outside of the tokens it replaces,
+// templates must not escape request macros again. The request time is in UTC so that it needs no escaping.
+func RedirectHandler(tpl *Template, values ...Value) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := make([]Value, 0, len(values)+1)
+		scope = append(scope, values...)
+		scope = append(scope, FromSource(newRequestSource(r, true)))
+		buf, release, err := tpl.Render(scope...)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		http.Redirect(w, r, string(buf), http.StatusFound)
+	})
+}
@@ -0,0 +1,93 @@
+package macros
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestRequest() *http.Request {
+	r := httptest.NewRequest("GET", "http://example.org/click?bidid=42&u=a&u=b", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "test")
+	r.Header.Set("Referer", "http://example.com")
+	r.Header.Add("X-Forwarded-For", "1.1.1.1")
+	r.Header.Add("X-Forwarded-For", "2.2.2.2")
+	r.AddCookie(&http.Cookie{Name: "uid", Value: "abc"})
+	return r
+}
+
+func TestRequest(t *testing.T) {
+	r := newTestRequest()
+	src := "${REMOTE_IP} ${USER_AGENT} ${REFERER} ${HOST} ${METHOD} ${PATH} ${query.bidid} ${header.x-forwarded-for} ${cookie.uid} ${*query.u}[${.}]${/query.u}"
+	buf, err := Replace(nil, src, Request(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "10.0.0.1 test http://example.com example.org GET /click 42 1.1.1.1,2.2.2.2 abc [a][b]"
+	if string(buf) != expect {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if _, err := Replace(nil, "${query.foo}", Request(r)); err != ErrMacroNotFound {
+		t.Errorf("Invalid error %v", err)
+	}
+	buf, err = Replace(nil, "${REQUEST_TIME}", Request(r))
+	if err != nil || len(buf) == 0 {
+		t.Errorf("Invalid request time %q %v", buf, err)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tpl := Must("http://partner.org/win?id=${query.bidid}&ip=${REMOTE_IP}&src=${SRC}${?query.gdpr}&gdpr=${query.gdpr}${/query.gdpr}")
+	h := RedirectHandler(tpl, String("SRC", "test"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newTestRequest())
+	if w.Code != http.StatusFound {
+		t.Errorf("Invalid status %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "http://partner.org/win?id=42&ip=10.0.0.1&src=test" {
+		t.Errorf("Invalid location %q", loc)
+	}
+	// Request data cannot inject parameters or change the target
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://example.org/click?bidid=1%26src%3Devil%23&gdpr=1", nil))
+	if loc := w.Header().Get("Location"); loc != "http://partner.org/win?id=1%26src%3Devil%23&ip=192.0.2.1&src=test&gdpr=1" {
+		t.Errorf("Invalid escaped location %q", loc)
+	}
+	w = httptest.NewRecorder()
+	RedirectHandler(Must("${query.to}")).ServeHTTP(w, httptest.NewRequest("GET", "http://example.org/?to=//evil.com/", nil))
+	if loc := w.Header().Get("Location"); loc != "/%2F%2Fevil.com%2F" {
+		t.Errorf("Invalid open redirect %q", loc)
+	}
+	local := time.Local
+	time.Local = time.FixedZone("X", 3600)
+	defer func() { time.Local = local }()
+	w = httptest.NewRecorder()
+	RedirectHandler(Must("/?t=${REQUEST_TIME}")).ServeHTTP(w, newTestRequest())
+	if loc := w.Header().Get("Location"); !strings.HasSuffix(loc, "Z") || strings.ContainsAny(loc, "+ ") {
+		t.Errorf("Invalid request time %q", loc)
+	}
+	w = httptest.NewRecorder()
+	RedirectHandler(Must("${FOO}")).ServeHTTP(w, newTestRequest())
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Invalid status %d", w.Code)
+	}
+}
+
+func TestRequestConcurrentLookup(t *testing.T) {
+	v := Request(newTestRequest())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if buf, err := Replace(nil, "${query.bidid}", v); err != nil || string(buf) != "42" {
+				t.Errorf("Invalid replacement %q %v", buf, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
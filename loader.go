@@ -0,0 +1,183 @@
+package macros
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Loader loads all templates under a directory of an `fs.FS` into a Set.
+// Templates are named by their path relative to the directory.
+// Each load creates a new Set that is swapped atomically so readers always get a consistent snapshot.
+type Loader struct {
+	fsys     fs.FS
+	dir      string
+	replacer *Replacer
+
+	mu          sync.Mutex // serializes loads
+	fingerprint uint64
+	set         atomic.Value
+}
+
+// NewLoader creates a loader for templates under `dir` of `fsys` parsed with `r`
+func NewLoader(fsys fs.FS, dir string, r *Replacer) *Loader {
+	if r == nil {
+		r = New()
+	}
+	l := Loader{
+		fsys:     fsys,
+		dir:      path.Clean(dir),
+		replacer: r,
+	}
+	l.set.Store(NewSet(r))
+	return &l
+}
+
+// Set returns a read-only snapshot of the loaded templates that later loads do not affect
+func (l *Loader) Set() *SetSnapshot {
+	return l.set.Load().(*Set).Snapshot()
+}
+
+// Lookup returns the loaded template named `name` or nil
+func (l *Loader) Lookup(name string) *Template {
+	return l.Set().Lookup(name)
+}
+
+// LoadError reports all files that failed to load
+type LoadError struct {
+	Errors []error
+}
+
+func (e *LoadError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Load loads all templates replacing the current snapshot.
+// If any template fails to parse the current snapshot is kept and all errors are returned as a `*LoadError`.
+func (l *Loader) Load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fingerprint, err := l.stat()
+	if err != nil {
+		return err
+	}
+	return l.load(fingerprint)
+}
+
+// Reload loads all templates if any file under the directory changed since the last load
+func (l *Loader) Reload() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fingerprint, err := l.stat()
+	if err != nil {
+		return false, err
+	}
+	if fingerprint == l.fingerprint {
+		return false, nil
+	}
+	return true, l.load(fingerprint)
+}
+
+// Poll reloads templates every `interval` until `ctx` is done.
+// Polling works with any filesystem that reports file sizes and modification times.
+// Reload errors are passed to `onError` if it is not nil.
+// A non-positive interval polls every `DefaultPollInterval`.
+func (l *Loader) Poll(ctx context.Context, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// DefaultPollInterval is the interval used by `Poll` for non-positive intervals
+const DefaultPollInterval = time.Second
+
+func (l *Loader) load(fingerprint uint64) error {
+	// Failed loads are not retried until the files change
+	l.fingerprint = fingerprint
+	var (
+		sources = make(map[string]string)
+		parsed  = make(map[string]*Template)
+		errs    []error
+	)
+	err := fs.WalkDir(l.fsys, l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(l.fsys, p)
+		if err != nil {
+			return err
+		}
+		name, src := l.name(p), string(data)
+		// Parse each file to report all errors, includes are resolved by the set
+		tpl, err := l.replacer.Parse(src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", name, err))
+		}
+		sources[name], parsed[name] = src, tpl
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &LoadError{errs}
+	}
+	set := NewSet(l.replacer)
+	if err := set.store(sources, parsed); err != nil {
+		return &LoadError{[]error{err}}
+	}
+	l.set.Store(set)
+	return nil
+}
+
+// stat computes a fingerprint of the paths, sizes and modification times of the files under the directory
+func (l *Loader) stat() (uint64, error) {
+	h := fnv.New64a()
+	err := fs.WalkDir(l.fsys, l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(h, "%s\x00%d\x00%d\n", p, info.Size(), info.ModTime().UnixNano())
+		return err
+	})
+	return h.Sum64(), err
+}
+
+func (l *Loader) name(p string) string {
+	if l.dir == "." {
+		return p
+	}
+	return strings.TrimPrefix(p, l.dir+"/")
+}
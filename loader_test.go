@@ -0,0 +1,109 @@
+package macros
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"partners/a/win.txt":     {Data: []byte("win=${PRICE}${>common/ip.txt}")},
+		"partners/common/ip.txt": {Data: []byte("&ip=${IP}")},
+		"other/x.txt":            {Data: []byte("${")},
+	}
+	l := NewLoader(fsys, "partners/", nil)
+	if err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := l.Set()
+	buf, err := snapshot.Replace(nil, "a/win.txt", String("PRICE", "1"), String("IP", "ip"))
+	if err != nil || string(buf) != "win=1&ip=ip" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	if changed, err := l.Reload(); changed || err != nil {
+		t.Errorf("Unexpected reload %v %v", changed, err)
+	}
+	fsys["partners/a/bad.txt"] = &fstest.MapFile{Data: []byte("${?A}")}
+	fsys["partners/b/bad.txt"] = &fstest.MapFile{Data: []byte("${FOO")}
+	changed, err := l.Reload()
+	if !changed {
+		t.Errorf("Expected reload")
+	}
+	lerr, ok := err.(*LoadError)
+	if !ok || len(lerr.Errors) != 2 {
+		t.Fatalf("Invalid error %v", err)
+	}
+	if lerr.Error() != "a/bad.txt: Unclosed section \"A\"\nb/bad.txt: Unmatched delimiter \"${\" at position 0" {
+		t.Errorf("Invalid error message %q", lerr)
+	}
+	if changed, _ := l.Reload(); changed {
+		t.Errorf("Unexpected reload of unchanged files")
+	}
+	if l.Set() != snapshot {
+		t.Errorf("Failed load replaced snapshot")
+	}
+	delete(fsys, "partners/a/bad.txt")
+	delete(fsys, "partners/b/bad.txt")
+	fsys["partners/a/win.txt"] = &fstest.MapFile{Data: []byte("win=${PRICE:hex}")}
+	if changed, err := l.Reload(); !changed || err != nil {
+		t.Errorf("Invalid reload %v %v", changed, err)
+	}
+	if l.Lookup("a/win.txt").String() != "win=${PRICE:hex}" {
+		t.Errorf("Invalid reloaded template %q", l.Lookup("a/win.txt"))
+	}
+	if s := snapshot.Lookup("a/win.txt").String(); s != "win=${PRICE}&ip=${IP}" {
+		t.Errorf("Snapshot modified %q", s)
+	}
+}
+
+func TestLoaderPoll(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "tpl.txt")
+	if err := os.WriteFile(file, []byte("v1=${A}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := NewLoader(os.DirFS(dir), ".", nil)
+	if err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.Poll(ctx, time.Millisecond, func(err error) {
+			t.Error(err)
+		})
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	if err := os.WriteFile(file, []byte("v2=${A}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if l.Lookup("tpl.txt").String() == "v2=${A}" {
+			return
+		}
+	}
+	t.Errorf("Template not reloaded")
+}
+
+func TestLoaderPollDefaultInterval(t *testing.T) {
+	l := NewLoader(fstest.MapFS{}, ".", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Non-positive intervals must not panic
+	l.Poll(ctx, 0, nil)
+	l.Poll(ctx, -time.Second, nil)
+}
@@ -40,12 +40,45 @@ func (token Token) Macro() string {
 	return string(m)
 }
 
-// Filters returns the filters of a token
-func (token Token) Filters() []string {
-	if _, filters := token.split(); len(filters) > 1 {
-		return strings.Split(string(filters[1:]), string(TokenDelimiter))
+// Filters returns the filters of a token including any arguments
+func (token Token) Filters() (filters []string) {
+	_, rest := token.split()
+	for len(rest) > 1 {
+		var filter Token
+		filter, rest = splitFilter(rest[1:])
+		filters = append(filters, string(filter))
 	}
-	return nil
+	return
+}
+
+// splitFilter splits the next filter ignoring delimiters in the filter argument
+func splitFilter(filters Token) (Token, Token) {
+	depth := 0
+	for i := 0; i < len(filters); i++ {
+		switch filters[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case TokenDelimiter:
+			if depth == 0 {
+				return filters[:i], filters[i:]
+			}
+		}
+	}
+	return filters, ""
+}
+
+// filterArg splits a filter to its name and argument, e.g. `fixed(4)`
+func filterArg(filter Token) (name string, arg string, ok bool) {
+	if n := len(filter); n > 0 && filter[n-1] == ')' {
+		if i := strings.IndexByte(string(filter), '('); i > 0 {
+			return string(filter[:i]), string(filter[i+1 : n-1]), true
+		}
+	}
+	return string(filter), "", false
 }
 
 func (token Token) split() (Token, Token) {
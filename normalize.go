@@ -0,0 +1,63 @@
+package macros
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Normalizer converts macro names to a canonical form
+type Normalizer func(macro Token) Token
+
+// Normalize sets normalizers applied to template macros at parse time, e.g. `Normalize(UpperCase, Underscores)`.
+// Values, aliases and skipped macros should use the normalized names, loop macros are normalized by the option.
+// Normalizers are applied after any normalizers set by previous options.
+// Normalizers are functions so they are not included in `Replacer.Config`.
+func Normalize(normalizers ...Normalizer) Option {
+	return optionFunc(func(p *Replacer) {
+		for _, n := range normalizers {
+			if n == nil {
+				continue
+			}
+			if prev := p.normalize; prev != nil {
+				n := n
+				p.normalize = func(macro Token) Token {
+					return n(prev(macro))
+				}
+			} else {
+				p.normalize = n
+			}
+		}
+		p.item, p.index = p.normalizeMacro(p.item), p.normalizeMacro(p.index)
+	})
+}
+
+func (r *Replacer) normalizeMacro(macro Token) Token {
+	if r.normalize == nil || macro == "" {
+		return macro
+	}
+	return r.normalize(macro)
+}
+
+// UpperCase is a normalizer converting macros to upper case
+func UpperCase(macro Token) Token {
+	return Token(strings.ToUpper(string(macro)))
+}
+
+// Underscores is a normalizer treating `-` as `_` in macros
+func Underscores(macro Token) Token {
+	return Token(strings.Replace(string(macro), "-", "_", -1))
+}
+
+type aliasPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// AliasPattern defines aliases for all macros matching `re`.
+// The macro is expanded from `replacement` as in `Regexp.ReplaceAllString`, e.g. `AliasPattern(regexp.MustCompile("^PARTNER_(.+)$"), "$1")`.
+// Patterns match normalized macros and are tried in order after exact aliases.
+func AliasPattern(re *regexp.Regexp, replacement string) Option {
+	return optionFunc(func(p *Replacer) {
+		p.aliasPatterns = append(p.aliasPatterns[:len(p.aliasPatterns):len(p.aliasPatterns)], aliasPattern{re, replacement})
+	})
+}
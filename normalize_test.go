@@ -0,0 +1,58 @@
+package macros
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	options := []Option{
+		Normalize(UpperCase, Underscores),
+		Alias("AUCTION_PRICE", "price"),
+		AliasPattern(regexp.MustCompile(`^PARTNER_(.+)$`), "$1"),
+		Filters{"hex": Hex},
+	}
+	src := "${auction_price} ${Auction_Price:hex} ${AUCTION-PRICE} ${price} ${partner-bid-id} ${?bid_id}ok${/Bid-Id}"
+	values := []Value{String("AUCTION_PRICE", "1"), String("BID_ID", "b")}
+	expect := "1 31 1 1 b ok"
+	tpl := Must(src, options...)
+	if s := tpl.String(); s != "${AUCTION_PRICE} ${AUCTION_PRICE:hex} ${AUCTION_PRICE} ${AUCTION_PRICE} ${BID_ID} ${?BID_ID}ok${/BID_ID}" {
+		t.Errorf("Invalid template %q", s)
+	}
+	if buf, err := tpl.Replace(nil, values...); err != nil || string(buf) != expect {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	if buf, err := New(options...).Replace(nil, "${auction-price} ${partner_bid_id}", values...); err != nil || string(buf) != "1 b" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	if alias := New(options...).Alias("partner-foo:hex"); alias != "FOO:hex" {
+		t.Errorf("Invalid alias %q", alias)
+	}
+}
+
+func TestNormalizeLoopMacros(t *testing.T) {
+	for _, options := range [][]Option{
+		{Normalize(UpperCase), LoopMacros("item", "i")},
+		{LoopMacros("item", "i"), Normalize(UpperCase)},
+	} {
+		buf, err := Must("${*list}${i}=${item}${/LIST}", options...).Replace(nil, List("LIST", String("", "a"), String("", "b")))
+		if err != nil || string(buf) != "0=a1=b" {
+			t.Errorf("Invalid replacement %q %v", buf, err)
+		}
+	}
+}
+
+func TestAliasPatternConfig(t *testing.T) {
+	r := New(AliasPattern(regexp.MustCompile(`^PARTNER_(.+)$`), "$1"))
+	c, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options, err := c.Options(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := New(options...).Replace(nil, "${PARTNER_ID}", String("ID", "x")); err != nil || string(buf) != "x" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+}
@@ -0,0 +1,284 @@
+package macros
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+// Fixed is a filter formatting a number with `arg` decimal digits.
+// Numbers are rounded half away from zero on their decimal representation.
+func Fixed(dst, value []byte, arg string) ([]byte, error) {
+	prec, err := strconv.Atoi(arg)
+	if err != nil || prec < 0 {
+		return dst, errInvalidPrecision
+	}
+	return appendDecimal(dst, value, 0, prec)
+}
+
+// Exp is a filter formatting a number in scientific notation with `arg` decimal digits
+func Exp(dst, value []byte, arg string) ([]byte, error) {
+	prec, err := strconv.Atoi(arg)
+	if err != nil || prec < 0 {
+		return dst, errInvalidPrecision
+	}
+	f, err := strconv.ParseFloat(string(value), 64)
+	if err != nil {
+		return dst, errInvalidNumber
+	}
+	return strconv.AppendFloat(dst, f, 'e', prec, 64), nil
+}
+
+// Micros is a filter converting a number to an integer of millionths, e.g. prices in micros
+func Micros(dst, value []byte) ([]byte, error) {
+	return appendDecimal(dst, value, 6, 0)
+}
+
+// Cents is a filter converting a number to an integer of hundredths
+func Cents(dst, value []byte) ([]byte, error) {
+	return appendDecimal(dst, value, 2, 0)
+}
+
+// Built-in number formatting filters
+var (
+	defaultFilters = Filters{
+		"micros": Micros,
+		"cents":  Cents,
+	}
+	defaultArgFilters = ArgFilters{
+		"fixed": Fixed,
+		"exp":   Exp,
+	}
+)
+
+// DefaultArgFilters returns a registry of the built-in filters with arguments.
+func DefaultArgFilters() ArgFilters {
+	return maps.Clone(defaultArgFilters)
+}
+
+var (
+	errInvalidNumber    = errors.New("Invalid number")
+	errInvalidPrecision = errors.New("Invalid precision")
+)
+
+// appendDecimal appends a decimal number value multiplied by 10^shift and rounded to `prec` decimal digits
+func appendDecimal(dst, value []byte, shift, prec int) ([]byte, error) {
+	var scratch, buf [64]byte
+	s := value
+	for _, c := range s {
+		if c == 'e' || c == 'E' {
+			// Convert scientific notation to decimal
+			f, err := strconv.ParseFloat(string(value), 64)
+			if err != nil {
+				return dst, errInvalidNumber
+			}
+			s = strconv.AppendFloat(scratch[:0], f, 'f', -1, 64)
+			break
+		}
+	}
+	neg := false
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	digits := buf[:0]
+	point := -1
+	for i, c := range s {
+		switch {
+		case '0' <= c && c <= '9':
+			digits = append(digits, c)
+		case c == '.' && point == -1:
+			point = i
+		default:
+			return dst, errInvalidNumber
+		}
+	}
+	if len(digits) == 0 {
+		return dst, errInvalidNumber
+	}
+	if point == -1 {
+		point = len(digits)
+	}
+	point += shift
+	keep := point + prec
+	for len(digits) < keep {
+		digits = append(digits, '0')
+	}
+	roundUp := keep < len(digits) && digits[keep] >= '5'
+	digits = digits[:keep]
+	if roundUp {
+		i := len(digits) - 1
+		for ; i >= 0 && digits[i] == '9'; i-- {
+			digits[i] = '0'
+		}
+		if i >= 0 {
+			digits[i]++
+		} else {
+			digits = append(digits[:1], digits...)
+			digits[0] = '1'
+			point++
+		}
+	}
+	intPart, fracPart := digits[:point], digits[point:]
+	for len(intPart) > 0 && intPart[0] == '0' {
+		intPart = intPart[1:]
+	}
+	if neg && !isZero(digits) {
+		dst = append(dst, '-')
+	}
+	if len(intPart) == 0 {
+		dst = append(dst, '0')
+	}
+	dst = append(dst, intPart...)
+	if len(fracPart) > 0 {
+		dst = append(dst, '.')
+		dst = append(dst, fracPart...)
+	}
+	return dst, nil
+}
+
+func isZero(digits []byte) bool {
+	for _, c := range digits {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	errDivisionByZero = errors.New("Division by zero")
+	errOverflow       = errors.New("Integer overflow")
+)
+
+// Add is a value filter adding `arg` to a number or a duration to a time value, e.g. `${TS:add(1h)}`
+func Add(v Value, arg string) (Value, error) {
+	if tm, ok := v.Time(); ok {
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return v, err
+		}
+		return Time(v.macro, tm.Add(d), v.str), nil
+	}
+	return arithmetic(v, arg, '+')
+}
+
+// Sub is a value filter subtracting `arg` from a number or a duration from a time value
+func Sub(v Value, arg string) (Value, error) {
+	if tm, ok := v.Time(); ok {
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return v, err
+		}
+		return Time(v.macro, tm.Add(-d), v.str), nil
+	}
+	return arithmetic(v, arg, '-')
+}
+
+// Mul is a value filter multiplying a number by `arg`
+func Mul(v Value, arg string) (Value, error) {
+	return arithmetic(v, arg, '*')
+}
+
+// Div is a value filter dividing a number by `arg`, the result is a float32 for float32 values and a float64 otherwise
+func Div(v Value, arg string) (Value, error) {
+	x, ok := v.Float()
+	if !ok {
+		return v, errInvalidNumber
+	}
+	y, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return v, errInvalidNumber
+	}
+	if y == 0 {
+		return v, errDivisionByZero
+	}
+	if v.typ == typeFloat32 {
+		return Float32(v.macro, float32(x/y)), nil
+	}
+	return Float64(v.macro, x/y), nil
+}
+
+// arithmetic uses integer arithmetic if both operands are integers and keeps the type of float operands.
+// Unsigned integers that do not fit in an int64 use unsigned arithmetic.
+func arithmetic(v Value, arg string, op byte) (Value, error) {
+	switch v.typ {
+	case typeInt, typeUint:
+		if v.typ == typeUint && v.num > math.MaxInt64 {
+			if y, err := strconv.ParseUint(arg, 10, 64); err == nil {
+				z, ok := uintOp(op, v.num, y)
+				if !ok {
+					return v, errOverflow
+				}
+				return Uint64(v.macro, z), nil
+			}
+			break
+		}
+		if y, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			z, ok := intOp(op, int64(v.num), y)
+			if !ok {
+				return v, errOverflow
+			}
+			return Int64(v.macro, z), nil
+		}
+	}
+	x, ok := v.Float()
+	if !ok {
+		return v, errInvalidNumber
+	}
+	y, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return v, errInvalidNumber
+	}
+	var z float64
+	switch op {
+	case '+':
+		z = x + y
+	case '-':
+		z = x - y
+	case '*':
+		z = x * y
+	}
+	if v.typ == typeFloat32 {
+		return Float32(v.macro, float32(z)), nil
+	}
+	return Float64(v.macro, z), nil
+}
+
+// intOp applies `op` reporting false on overflow
+func intOp(op byte, x, y int64) (int64, bool) {
+	switch op {
+	case '+':
+		z := x + y
+		return z, (x^z)&(y^z) >= 0
+	case '-':
+		z := x - y
+		return z, (x^y)&(x^z) >= 0
+	case '*':
+		if x == 0 || y == 0 {
+			return 0, true
+		}
+		z := x * y
+		return z, z/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64)
+	}
+	return 0, false
+}
+
+// uintOp applies `op` reporting false on overflow
+func uintOp(op byte, x, y uint64) (uint64, bool) {
+	switch op {
+	case '+':
+		z, carry := bits.Add64(x, y, 0)
+		return z, carry == 0
+	case '-':
+		z, borrow := bits.Sub64(x, y, 0)
+		return z, borrow == 0
+	case '*':
+		hi, z := bits.Mul64(x, y)
+		return z, hi == 0
+	}
+	return 0, false
+}
@@ -0,0 +1,126 @@
+package macros
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNumberFilters(t *testing.T) {
+	for _, tc := range []struct {
+		Filter string
+		Value  string
+		Expect string
+	}{
+		{"fixed(2)", "1.005", "1.01"},
+		{"fixed(2)", "-1.005", "-1.01"},
+		{"fixed(4)", "4.2", "4.2000"},
+		{"fixed(0)", "9.5", "10"},
+		{"fixed(0)", "-0.4", "0"},
+		{"fixed(1)", ".99", "1.0"},
+		{"fixed(3)", "1e-3", "0.001"},
+		{"micros", "0.0000015", "2"},
+		{"micros", "1.5", "1500000"},
+		{"micros", "-42", "-42000000"},
+		{"cents", "19.999", "2000"},
+		{"cents", "0.01", "1"},
+		{"exp(2)", "1234.5", "1.23e+03"},
+	} {
+		name, arg, ok := filterArg(Token(tc.Filter))
+		var (
+			buf []byte
+			err error
+		)
+		if ok {
+			buf, err = DefaultArgFilters()[name](nil, []byte(tc.Value), arg)
+		} else {
+			buf, err = DefaultFilters()[name](nil, []byte(tc.Value))
+		}
+		if err != nil {
+			t.Errorf("%s(%s): Unexpected error %s", tc.Filter, tc.Value, err)
+		} else if string(buf) != tc.Expect {
+			t.Errorf("%s(%s): Invalid result %q != %q", tc.Filter, tc.Value, buf, tc.Expect)
+		}
+	}
+	for _, v := range []string{"", "-", "1.2.3", "abc", "1,5"} {
+		if _, err := Micros(nil, []byte(v)); err == nil {
+			t.Errorf("Expected error for %q", v)
+		}
+	}
+	if _, err := Fixed(nil, []byte("1"), "x"); err == nil {
+		t.Errorf("Expected precision error")
+	}
+}
+
+func TestNumberFiltersTemplate(t *testing.T) {
+	tpl := Must("${PRICE:fixed(4)} ${PRICE:micros} ${PRICE:cents:hex} ${F32} ${F32:fixed(2)}",
+		DefaultFilters(), DefaultArgFilters())
+	buf, err := tpl.Replace(nil, Float64("PRICE", 1.23456), Float32("F32", 0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "1.2346 1234560 313233 0.1 0.10" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if f32, _ := Replace(nil, "${F}", Any("F", float32(0.1))); string(f32) != "0.1" {
+		t.Errorf("Invalid float32 %q", f32)
+	}
+	if tokens := Token("TS:format(15:04):tz(UTC)").Filters(); len(tokens) != 2 || tokens[0] != "format(15:04)" {
+		t.Errorf("Invalid filters %q", tokens)
+	}
+}
+
+func TestValueFilters(t *testing.T) {
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tpl := Must("${PRICE:mul(1000):fixed(2)} ${N:add(2)} ${N:sub(0.5)} ${N:div(4)} ${TS:add(1h):unix} ${TS:sub(24h):format(2006-01-02)} ${PRICE:cents:div(100)} ${N:double}",
+		DefaultFilters(), DefaultArgFilters(), ValueFilters{
+			"double": func(v Value, _ string) (Value, error) {
+				n, _ := v.Int()
+				return Int64(v.Macro(), 2*n), nil
+			},
+		})
+	values := []Value{Float64("PRICE", 1.23456), Int("N", 5), Time("TS", tm, "")}
+	buf, err := tpl.Replace(nil, values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "1234.56 7 4.5 1.25 1577937845 2020-01-01 1.23 10"; string(buf) != expect {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if size := tpl.EstimateSizeFor(values...); size < len(buf) {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+	for _, src := range []string{"${N:div(0)}", "${N:mul(foo)}", "${S:add(1)}", "${N:add(1h)}"} {
+		if _, err := Replace(nil, src, Int("N", 1), String("S", "foo")); err == nil {
+			t.Errorf("Expected error for %q", src)
+		}
+	}
+	for _, src := range []string{"${I:add(1)}", "${I:mul(2)}", "${J:sub(1)}", "${U:add(1)}", "${U:mul(2)}"} {
+		if _, err := Replace(nil, src, Int64("I", math.MaxInt64), Int64("J", math.MinInt64), Uint64("U", math.MaxUint64)); err != errOverflow {
+			t.Errorf("Expected overflow error for %q %v", src, err)
+		}
+	}
+	buf, err = Replace(nil, "${U:sub(1)} ${U:add(0):sub(18446744073709551614)} ${F:add(0.1)} ${F:div(3)}", Uint64("U", math.MaxUint64), Float32("F", 0.2))
+	if expect := "18446744073709551614 1 0.3 0.06666667"; err != nil || string(buf) != expect {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	// Registered byte filters override built-in value filters
+	buf, err = Must("${N:add}", Filters{"add": Hex}).Replace(nil, Int("N", 1))
+	if err != nil || string(buf) != "31" {
+		t.Errorf("Invalid override %q %v", buf, err)
+	}
+}
+
+func TestBuiltinNumberFilters(t *testing.T) {
+	buf, err := Replace(nil, "${P:fixed(2)} ${P:exp(1)} ${P:micros} ${P:cents}", Float64("P", 1.5))
+	if expect := "1.50 1.5e+00 1500000 150"; err != nil || string(buf) != expect {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	// Registered filters override built-in filters
+	buf, err = Must("${P:cents} ${P:fixed(2)}", Filters{"cents": Hex}, ArgFilters{"fixed": func(dst, _ []byte, arg string) ([]byte, error) {
+		return append(dst, arg...), nil
+	}}).Replace(nil, Float64("P", 1.5))
+	if expect := "312e35 2"; err != nil || string(buf) != expect {
+		t.Errorf("Invalid override %q %v", buf, err)
+	}
+}
@@ -1,6 +1,7 @@
 package macros
 
 import (
+	"regexp"
 	"strings"
 )
 
@@ -27,15 +28,60 @@ func Delimiters(start, end string) Option {
 			end = defaultEndDelimiter
 		}
 		p.start, p.end = start, end
+		p.pairs = nil
+	})
+}
+
+// DelimiterPair is a pair of start and end delimiters
+type DelimiterPair struct {
+	Start string
+	End   string
+}
+
+// DelimiterPairs sets several delimiter pairs that can be mixed in the same template, e.g. `${X}`, `{X}` and `%%X%%`.
+// If start delimiters match at the same position the longest one wins.
+// The first pair is the primary pair returned by `Replacer.Delimiters`.
+// Pairs with empty delimiters are ignored.
+func DelimiterPairs(pairs ...DelimiterPair) Option {
+	return optionFunc(func(p *Replacer) {
+		var valid []DelimiterPair
+		for _, pair := range pairs {
+			pair.Start, pair.End = strings.TrimSpace(pair.Start), strings.TrimSpace(pair.End)
+			if pair.Start != "" && pair.End != "" {
+				valid = append(valid, pair)
+			}
+		}
+		if len(valid) == 0 {
+			return
+		}
+		p.start, p.end = valid[0].Start, valid[0].End
+		p.pairs = nil
+		if len(valid) > 1 {
+			p.pairs = valid
+		}
+	})
+}
+
+// LoopMacros sets the macros bound to the current item and index inside loop sections
+func LoopMacros(item, index Token) Option {
+	return optionFunc(func(p *Replacer) {
+		item, _ = item.split()
+		index, _ = index.split()
+		p.item, p.index = p.normalizeMacro(item), p.normalizeMacro(index)
+	})
+}
+
+// LoopSeparator sets the separator rendered between loop section items
+func LoopSeparator(sep string) Option {
+	return optionFunc(func(p *Replacer) {
+		p.sep = sep
 	})
 }
 
 // Alias defines aliases for a macro
 func Alias(macro Token, aliases ...Token) Option {
 	return optionFunc(func(p *Replacer) {
-		if p.alias == nil {
-			p.alias = make(map[Token]Token)
-		}
+		p.alias = writable(p, p.alias, ownAlias)
 		macro, _ = macro.split()
 		for _, alias := range aliases {
 			alias, _ = alias.split()
@@ -54,13 +100,26 @@ func DefaultValue(value string) Option {
 // Skip defines macros that will not be replaced
 func Skip(macros ...Token) Option {
 	return optionFunc(func(p *Replacer) {
-		if p.skip == nil {
-			p.skip = make(map[Token]struct{}, len(macros))
-		}
+		p.skip = writable(p, p.skip, ownSkip)
 		for _, token := range macros {
-			p.skip[token] = struct{}{}
+			macro, _ := token.split()
+			p.skip[macro] = struct{}{}
 		}
 	})
+}
+
+// SkipPrefix defines prefixes of macros that will not be replaced, e.g. `PARTNER_`
+func SkipPrefix(prefixes ...string) Option {
+	return optionFunc(func(p *Replacer) {
+		p.skipPrefix = append(p.skipPrefix[:len(p.skipPrefix):len(p.skipPrefix)], prefixes...)
+	})
+}
+
+// SkipMatching defines a pattern for macros that will not be replaced
+func SkipMatching(re *regexp.Regexp) Option {
+	return optionFunc(func(p *Replacer) {
+		p.skipMatch = append(p.skipMatch[:len(p.skipMatch):len(p.skipMatch)], re)
+	})
 
 }
 
@@ -70,9 +129,7 @@ type expand struct {
 }
 
 func (e expand) apply(r *Replacer) {
-	if r.expand == nil {
-		r.expand = make(map[Token]string)
-	}
+	r.expand = writable(r, r.expand, ownExpand)
 	r.expand[e.macro] = e.tpl
 }
 
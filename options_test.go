@@ -1,6 +1,10 @@
 package macros
 
-import "testing"
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
 
 func TestDelimiters(t *testing.T) {
 	{
@@ -17,6 +21,56 @@ func TestDelimiters(t *testing.T) {
 
 }
 
+func TestDelimiterPairs(t *testing.T) {
+	options := DelimiterPairs(
+		DelimiterPair{"${", "}"},
+		DelimiterPair{"{", "}"},
+		DelimiterPair{"[", "]"},
+		DelimiterPair{"%%", "%%"},
+		DelimiterPair{"%", "%"},
+		DelimiterPair{"", "x"},
+	)
+	src := "a=${A}&b={B}&c=[C]&d=%%D%%&e=%E%&${?A}[A:hex]{/A}"
+	tpl := Must(src, options, Filters{"hex": Hex})
+	buf, err := tpl.Replace(nil, String("A", "1"), String("B", "2"), String("C", "3"), String("D", "4"), String("E", "5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "a=1&b=2&c=3&d=4&e=5&31" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if s := tpl.String(); s != src {
+		t.Errorf("Invalid template string %q", s)
+	}
+	r := New(options)
+	if start, end := r.Delimiters(); start != "${" || end != "}" {
+		t.Errorf("Invalid primary delimiters %q %q", start, end)
+	}
+	if pairs := r.DelimiterPairs(); len(pairs) != 5 {
+		t.Errorf("Invalid pairs %v", pairs)
+	}
+	if buf, err := r.Replace(nil, "%%D%% [C]", String("C", "3"), String("D", "4")); err != nil || string(buf) != "4 3" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	if _, err := r.Replace(nil, "[C"); err == nil {
+		t.Errorf("Expected unmatched delimiter error")
+	}
+	if start, _ := New(options, Delimiters("<", ">")).Delimiters(); start != "<" {
+		t.Errorf("Invalid delimiters override %q", start)
+	}
+	loaded, err := LoadOptions("test.json", strings.NewReader(`{"delimiters": ["{{", "}}", "[", "]"]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(loaded...).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.Delimiters, " ") != "{{ }} [ ]" {
+		t.Errorf("Invalid config delimiters %q", c.Delimiters)
+	}
+}
+
 func TestAlias(t *testing.T) {
 	r := New(Alias("foo", "FOO", "Foo"))
 	if alias := r.Alias("Foo"); alias != "foo" {
@@ -47,3 +101,42 @@ func TestSkip(t *testing.T) {
 		t.Errorf("Invalid replacement %q", b)
 	}
 }
+
+func TestSkipOriginalText(t *testing.T) {
+	options := []Option{
+		Skip("foo:hex"),
+		Alias("foo", "FOO"),
+		SkipPrefix("PARTNER_"),
+		SkipMatching(regexp.MustCompile(`^ext\.[a-z]+$`)),
+		Filters{"hex": Hex},
+	}
+	src := "${ FOO:hex } ${PARTNER_ID} ${ext.uid} ${ext.UID} ${BAR}"
+	values := []Value{String("foo", "x"), String("PARTNER_ID", "x"), String("ext.uid", "x"), String("ext.UID", "y"), String("BAR", "z")}
+	expect := "${ FOO:hex } ${PARTNER_ID} ${ext.uid} y z"
+	r := New(options...)
+	if buf, err := r.Replace(nil, src, values...); err != nil || string(buf) != expect {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	tpl := Must(src, options...)
+	buf, err := tpl.Replace(nil, values...)
+	if err != nil || string(buf) != expect {
+		t.Errorf("Invalid template replacement %q %v", buf, err)
+	}
+	if size := tpl.EstimateSizeFor(values...); size < len(buf) {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+	if s := tpl.Partial(values...).String(); s != "${foo:hex} ${PARTNER_ID} ${ext.uid} y z" {
+		t.Errorf("Invalid partial %q", s)
+	}
+	shell := New(ShellSyntax(), SkipPrefix("PARTNER_"))
+	if buf, err := shell.Replace(nil, "$PARTNER_ID ${PARTNER_ID}", values...); err != nil || string(buf) != "$PARTNER_ID ${PARTNER_ID}" {
+		t.Errorf("Invalid shell replacement %q %v", buf, err)
+	}
+	c, err := New(options...).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Skip) != 1 || c.Skip[0] != "foo" || c.SkipPrefix[0] != "PARTNER_" || c.SkipMatching[0] != `^ext\.[a-z]+$` {
+		t.Errorf("Invalid config %v", c)
+	}
+}
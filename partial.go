@@ -0,0 +1,129 @@
+package macros
+
+// Partial renders the tokens of the template that have a value and returns a new template with the remaining tokens.
+// Sections on macros with a value are resolved and loops over them are unrolled
+// unless a token that is kept references the loop item or index.
+// Tokens that fail to render are kept so that errors are reported when the new template is rendered.
+func (t *Template) Partial(values ...Value) *Template {
+	var p partialBuilder
+	t.config.partial(&p, t.chunks, t.tail, values)
+	return &Template{
+		chunks: p.chunks,
+		tail:   string(p.text),
+		config: *t.config.clone(),
+	}
+}
+
+// partialBuilder collects text until the next remaining token
+type partialBuilder struct {
+	chunks []chunk
+	text   []byte
+}
+
+func (p *partialBuilder) add(c chunk) {
+	c.prefix = string(p.text)
+	p.text = p.text[:0]
+	p.chunks = append(p.chunks, c)
+}
+
+func (r *Replacer) partial(p *partialBuilder, chunks []chunk, tail string, values []Value) {
+	for i := range chunks {
+		c := &chunks[i]
+		p.text = append(p.text, c.prefix...)
+		if c.section != nil {
+			r.partialSection(p, c, values)
+			continue
+		}
+		macro, _ := c.token.split()
+		if _, ok := r.lookup(macro, values); ok && !r.skipped(macro) {
+			text, n := p.text, len(p.text)
+			if buf, err := r.replaceToken(text, c.token, values); err == nil {
+				p.text = buf
+				continue
+			}
+			p.text = text[:n]
+		}
+		p.add(*c)
+	}
+	p.text = append(p.text, tail...)
+}
+
+func (r *Replacer) partialSection(p *partialBuilder, c *chunk, values []Value) {
+	s := c.section
+	v, ok := r.lookup(c.token, values)
+	if !ok {
+		r.partialKeep(p, c, values)
+		return
+	}
+	if s.kind != SectionEach {
+		present := r.isPresent(p.text, c.token, values)
+		if present != (s.kind == SectionNot) {
+			r.partial(p, s.chunks, s.tail, values)
+		}
+		return
+	}
+	var (
+		item, index = r.LoopMacros()
+		scope       = make([]Value, 2, len(values)+2)
+		loop        partialBuilder
+	)
+	scope = append(scope, values...)
+	for i, n := 0, v.size(); i < n; i++ {
+		if i > 0 {
+			loop.text = append(loop.text, r.sep...)
+		}
+		scope[0] = v.item(item, i)
+		scope[1] = Int(index, i)
+		r.partial(&loop, s.chunks, s.tail, scope)
+	}
+	// Kept tokens cannot reference the loop item or index once the loop is unrolled
+	if references(loop.chunks, item, index) {
+		r.partialKeep(p, c, values)
+		return
+	}
+	for _, unrolled := range loop.chunks {
+		p.text = append(p.text, unrolled.prefix...)
+		p.add(unrolled)
+	}
+	p.text = append(p.text, loop.text...)
+}
+
+// partialKeep keeps a section rendering the tokens of its body that have a value
+func (r *Replacer) partialKeep(p *partialBuilder, c *chunk, values []Value) {
+	s := c.section
+	if s.kind == SectionEach {
+		// Loops rebind the item and index macros in their body
+		item, index := r.LoopMacros()
+		outer := make([]Value, 0, len(values))
+		for _, v := range values {
+			if v.macro != item && v.macro != index {
+				outer = append(outer, v)
+			}
+		}
+		values = outer
+	}
+	var body partialBuilder
+	r.partial(&body, s.chunks, s.tail, values)
+	kept := *c
+	kept.section = &section{
+		kind:   s.kind,
+		chunks: body.chunks,
+		tail:   string(body.text),
+		delim:  s.delim,
+	}
+	p.add(kept)
+}
+
+// references reports whether any token references `item` or `index` outside of nested loops that rebind them
+func references(chunks []chunk, item, index Token) bool {
+	for i := range chunks {
+		c := &chunks[i]
+		if macro, _ := c.token.split(); macro == item || macro == index {
+			return true
+		}
+		if s := c.section; s != nil && s.kind != SectionEach && references(s.chunks, item, index) {
+			return true
+		}
+	}
+	return false
+}
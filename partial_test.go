@@ -0,0 +1,48 @@
+package macros
+
+import "testing"
+
+func TestPartial(t *testing.T) {
+	tpl := Must("id=${CREATIVE_ID}&p=${PRICE:hex}&x=${FOO:hex}${?DEBUG}&debug=1${/DEBUG}${?CLICK}&c=${CLICK}${/CLICK}&s=${*SIZES}${.}x${H}${/SIZES}",
+		Filters{"hex": Hex}, LoopSeparator(","))
+	partial := tpl.Partial(String("CREATIVE_ID", "42"), String("FOO", "foo"), String("DEBUG", ""), List("SIZES", Int("", 300), Int("", 728)))
+	if s := partial.String(); s != "id=42&p=${PRICE:hex}&x=666f6f${?CLICK}&c=${CLICK}${/CLICK}&s=300x${H},728x${H}" {
+		t.Errorf("Invalid partial template %q", s)
+	}
+	if tokens := partial.Tokens(); len(tokens) != 5 {
+		t.Errorf("Invalid tokens %q", tokens)
+	}
+	buf, err := partial.Replace(nil, String("PRICE", "1"), String("CLICK", "c"), Int("H", 90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "id=42&p=31&x=666f6f&c=c&s=300x90,728x90" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	expect, _ := tpl.Replace(nil, String("CREATIVE_ID", "42"), String("FOO", "foo"), String("DEBUG", ""), List("SIZES", Int("", 300), Int("", 728)),
+		String("PRICE", "1"), String("CLICK", "c"), Int("H", 90))
+	if string(buf) != string(expect) {
+		t.Errorf("Partial rendering differs %q != %q", buf, expect)
+	}
+	if s := Must("${A:foo}").Partial(String("A", "a")).String(); s != "${A:foo}" {
+		t.Errorf("Invalid partial with failing token %q", s)
+	}
+}
+
+func TestPartialKeepsLoopWithItemReferences(t *testing.T) {
+	tpl := Must("${*L}${.:foo}-${#}-${A}${/L}")
+	values := []Value{List("L", String("", "a"), String("", "b")), String("A", "x")}
+	partial := tpl.Partial(values...)
+	if s := partial.String(); s != "${*L}${.:foo}-${#}-x${/L}" {
+		t.Errorf("Invalid partial template %q", s)
+	}
+	foo := Filters{"foo": Hex}
+	buf, err := Must(partial.String(), foo).Replace(nil, values...)
+	if err != nil || string(buf) != "61-0-x62-1-x" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	// Nested loops rebind the loop macros
+	if s := Must("${*L}${*M}${.:foo}${/M}${/L}", foo).Partial(values...).String(); s != "${*M}${.:foo}${/M}${*M}${.:foo}${/M}" {
+		t.Errorf("Invalid nested partial %q", s)
+	}
+}
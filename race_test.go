@@ -0,0 +1,5 @@
+//go:build race
+
+package macros
+
+const raceEnabled = true
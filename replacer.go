@@ -4,19 +4,59 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
 	"sort"
 	"strings"
 )
 
-// Replacer is a macro template Replacer
+// Replacer is a macro template Replacer.
+// A Replacer is immutable once created and safe for concurrent use.
+// Templates keep a copy of the configuration they were parsed with and use `With` to derive new Replacers.
 type Replacer struct {
-	start   string
-	end     string
-	filters Filters
-	none    Value
-	skip    map[Token]struct{}
-	alias   map[Token]Token
-	expand  map[Token]string
+	start         string
+	end           string
+	pairs         []DelimiterPair
+	filters       Filters
+	argFilters    ArgFilters
+	valueFilters  ValueFilters
+	none          Value
+	skip          map[Token]struct{}
+	skipPrefix    []string
+	skipMatch     []*regexp.Regexp
+	alias         map[Token]Token
+	aliasPatterns []aliasPattern
+	normalize     Normalizer
+	expand        map[Token]string
+	item          Token
+	index         Token
+	sep           string
+	shell         bool
+	owns          owned
+}
+
+// owned flags the maps owned by a Replacer, shared maps are copied before they are modified
+type owned uint8
+
+const (
+	ownFilters owned = 1 << iota
+	ownArgFilters
+	ownValueFilters
+	ownSkip
+	ownAlias
+	ownExpand
+)
+
+// writable returns a map that `r` can modify copying `m` if it is shared with other Replacers
+func writable[M ~map[K]V, K comparable, V interface{}](r *Replacer, m M, flag owned) M {
+	if r.owns&flag != 0 && m != nil {
+		return m
+	}
+	r.owns |= flag
+	w := make(M, len(m))
+	for k, v := range m {
+		w[k] = v
+	}
+	return w
 }
 
 // New creates a new `Replacer` applying options
@@ -38,12 +78,61 @@ func (r *Replacer) Delimiters() (start string, end string) {
 	return
 }
 
+// DelimiterPairs returns all delimiter pairs of the Replacer starting with the primary pair
+func (r *Replacer) DelimiterPairs() []DelimiterPair {
+	if len(r.pairs) > 0 {
+		return append([]DelimiterPair(nil), r.pairs...)
+	}
+	start, end := r.Delimiters()
+	return []DelimiterPair{{start, end}}
+}
+
+const defaultLoopItem = "."
+const defaultLoopIndex = "#"
+
+// LoopMacros returns the macros bound to the current item and index inside loop sections
+func (r *Replacer) LoopMacros() (item Token, index Token) {
+	item, index = r.item, r.index
+	if item == "" {
+		item = defaultLoopItem
+	}
+	if index == "" {
+		index = defaultLoopIndex
+	}
+	return
+}
+
+// HasFilter reports whether a filter, e.g. `hex` or `fixed(2)`, is registered or built-in
+func (r *Replacer) HasFilter(filter string) bool {
+	name, _, hasArg := filterArg(Token(filter))
+	if hasArg && r.argFilter(name) != nil || !hasArg && r.filter(name) != nil {
+		return true
+	}
+	return r.valueFilter(name) != nil
+}
+
 var errEOF = errors.New("EOF")
 
-// Parse compiles a new template using `r` options
+// With creates a new Replacer applying options to a copy of `r`.
+// Filters, aliases, skips and expansions are shared with `r` until an option modifies them in the child.
+func (r *Replacer) With(options ...Option) *Replacer {
+	child := r.clone()
+	child.applyOptions(options)
+	return child
+}
+
+// clone returns a copy of the configuration sharing all maps copy-on-write.
+// Slices are only appended at full capacity so they are never modified in place either.
+func (r *Replacer) clone() *Replacer {
+	c := *r
+	c.owns = 0
+	return &c
+}
+
+// Parse compiles a new template using a copy of `r` options
 func (r *Replacer) Parse(s string) (*Template, error) {
 	t := Template{
-		config: *r,
+		config: *r.clone(),
 	}
 	if err := t.parse(s); err != nil {
 		return nil, err
@@ -51,21 +140,44 @@ func (r *Replacer) Parse(s string) (*Template, error) {
 	return &t, nil
 }
 
-// Alias returns an alias for a token
+// Alias returns an alias for a token.
+// Exact aliases are tried before and after normalizing the macro and then alias patterns in order.
 func (r *Replacer) Alias(token Token) Token {
 	if pos := strings.IndexByte(string(token), TokenDelimiter); 0 <= pos && pos < len(token) {
 		macro, filters := token[:pos], token[pos:]
-		if alias, ok := r.alias[macro]; ok {
+		if alias, ok := r.resolve(macro); ok {
 			return alias + filters
 		}
 		return token
 	}
-	if alias, ok := r.alias[token]; ok {
+	if alias, ok := r.resolve(token); ok {
 		return alias
 	}
 	return token
 }
 
+func (r *Replacer) resolve(macro Token) (Token, bool) {
+	if alias, ok := r.alias[macro]; ok {
+		return alias, true
+	}
+	if r.normalize == nil && len(r.aliasPatterns) == 0 {
+		return macro, false
+	}
+	normalized := macro
+	if r.normalize != nil {
+		normalized = r.normalize(macro)
+		if alias, ok := r.alias[normalized]; ok {
+			return alias, true
+		}
+	}
+	for _, p := range r.aliasPatterns {
+		if p.re.MatchString(string(normalized)) {
+			return Token(p.re.ReplaceAllString(string(normalized), p.replacement)), true
+		}
+	}
+	return normalized, normalized != macro
+}
+
 const minBufferSize = 64
 
 func (r *Replacer) applyOptions(options []Option) {
@@ -74,11 +186,15 @@ func (r *Replacer) applyOptions(options []Option) {
 	}
 }
 
-// Replace appends the template to a buffer replacing tokens with values
+// Replace appends the template to a buffer replacing tokens with values.
+// Tokens are replaced as they are parsed until the first section token,
+// the rest of the template from that token on is parsed into a `Template` before rendering it.
+// Loop sections iterate `List` and `Concat` values, any other value including slices bound with `Any` is a single item.
 func (r *Replacer) Replace(buf []byte, tpl string, values ...Value) ([]byte, error) {
 	var (
 		err      error
 		original = buf[:]
+		src      = tpl
 		chunk    chunk
 	)
 	for len(tpl) > 0 {
@@ -88,8 +204,22 @@ func (r *Replacer) Replace(buf []byte, tpl string, values ...Value) ([]byte, err
 			}
 			return original, err
 		}
+		if isSectionToken(chunk.token) {
+			// Sections need the structure of the rest of the template, the raw token precedes it in the source
+			t, err := r.Parse(src[len(src)-len(tpl)-len(chunk.raw):])
+			if err != nil {
+				return original, err
+			}
+			if buf, err = t.Replace(append(buf, chunk.prefix...), values...); err != nil {
+				return original, err
+			}
+			return buf, nil
+		}
+		if r.normalize != nil || len(r.aliasPatterns) > 0 {
+			chunk.token = r.Alias(chunk.token)
+		}
 		buf = append(buf, chunk.prefix...)
-		if buf, err = r.replaceToken(buf, chunk.token, values); err != nil {
+		if buf, err = r.replaceChunk(buf, &chunk, values); err != nil {
 			return original, err
 		}
 	}
@@ -101,25 +231,58 @@ func unmatchedDelimiterError(d string, pos int) error {
 }
 
 func (r *Replacer) parseToken(s string, chunk *chunk) (string, error) {
+	if r.shell {
+		return r.parseShellToken(s, chunk)
+	}
+	if len(r.pairs) > 0 {
+		return r.parseMultiDelimited(s, chunk)
+	}
 	start, end := r.Delimiters()
 	if i := strings.Index(s, start); 0 <= i && i < len(s) {
-		var src string
-		chunk.prefix, src = s[:i], s[i:]
-		if n := len(start); 0 <= n && n < len(src) {
-			src := src[n:]
-			if i := strings.Index(src, end); 0 <= i && i <= len(src) {
-				token := src[:i]
-				if strings.Index(token, end) != -1 {
-					return s, unmatchedDelimiterError(start, i)
-				}
-				i += len(end)
-				chunk.token = Token(strings.TrimSpace(token))
-				return src[i:], nil
+		chunk.delim = 0
+		return parseDelimited(s, i, start, end, chunk)
+	}
+	return s, errEOF
+}
+
+// parseMultiDelimited parses the token with the earliest start delimiter, the longest start delimiter wins ties
+func (r *Replacer) parseMultiDelimited(s string, chunk *chunk) (string, error) {
+	pos, match := -1, -1
+	for i := range r.pairs {
+		start := r.pairs[i].Start
+		j := strings.Index(s, start)
+		if j == -1 {
+			continue
+		}
+		if match == -1 || j < pos || j == pos && len(start) > len(r.pairs[match].Start) {
+			pos, match = j, i
+		}
+	}
+	if match == -1 {
+		return s, errEOF
+	}
+	chunk.delim = match
+	return parseDelimited(s, pos, r.pairs[match].Start, r.pairs[match].End, chunk)
+}
+
+// parseDelimited parses a token delimited by `start` and `end` starting at `i`
+func parseDelimited(s string, i int, start, end string, chunk *chunk) (string, error) {
+	var src string
+	chunk.prefix, src = s[:i], s[i:]
+	if n := len(start); 0 <= n && n < len(src) {
+		src := src[n:]
+		if i := strings.Index(src, end); 0 <= i && i <= len(src) {
+			token := src[:i]
+			if strings.Index(token, end) != -1 {
+				return s, unmatchedDelimiterError(start, i)
 			}
+			i += len(end)
+			chunk.token = Token(strings.TrimSpace(token))
+			chunk.raw = s[len(chunk.prefix) : len(s)-len(src)+i]
+			return src[i:], nil
 		}
-		return s, unmatchedDelimiterError(start, i)
 	}
-	return s, errEOF
+	return s, unmatchedDelimiterError(start, i)
 }
 
 func (r *Replacer) appendToken(buf []byte, macro, filters Token) []byte {
@@ -130,6 +293,39 @@ func (r *Replacer) appendToken(buf []byte, macro, filters Token) []byte {
 	return append(buf, end...)
 }
 
+// replaceChunk replaces a parsed token keeping the original text of skipped tokens
+func (r *Replacer) replaceChunk(buf []byte, c *chunk, values []Value) ([]byte, error) {
+	if c.raw != "" && r.skipped(c.token) {
+		return append(buf, c.raw...), nil
+	}
+	return r.replaceToken(buf, c.token, values)
+}
+
+// skipped checks if the macro of a token is skipped after resolving aliases
+func (r *Replacer) skipped(token Token) bool {
+	if len(r.skip) == 0 && len(r.skipPrefix) == 0 && len(r.skipMatch) == 0 {
+		return false
+	}
+	macro, _ := token.split()
+	if alias, ok := r.alias[macro]; ok {
+		macro = alias
+	}
+	if _, skip := r.skip[macro]; skip {
+		return true
+	}
+	for _, prefix := range r.skipPrefix {
+		if strings.HasPrefix(string(macro), prefix) {
+			return true
+		}
+	}
+	for _, re := range r.skipMatch {
+		if re.MatchString(string(macro)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Replacer) replaceToken(buf []byte, token Token, values []Value) ([]byte, error) {
 	var (
 		err            error
@@ -140,24 +336,27 @@ func (r *Replacer) replaceToken(buf []byte, token Token, values []Value) ([]byte
 	if alias, ok := r.alias[macro]; ok {
 		macro = alias
 	}
-	if _, skip := r.skip[macro]; skip {
+	if r.skipped(macro) {
 		return r.appendToken(buf, macro, filters), nil
 	}
+	if r.shell {
+		if op, arg := shellOp(filters); op != 0 {
+			return r.replaceShellToken(buf, macro, op, arg, values)
+		}
+	}
 	if exp, ok := r.expand[macro]; ok {
 		buf, err = r.Replace(buf, exp, values...)
 		if err != nil {
 			return buf[:offset], fmt.Errorf("Expand %q failed: %s", macro, err)
 		}
 	} else {
-		var v *Value
-		for i := range values {
-			v = &values[i]
-			if v.macro == macro {
-				goto done
-			}
+		v, ok := r.lookup(macro, values)
+		if !ok {
+			v = r.none
+		}
+		if v, filters, err = r.applyValueFilters(v, filters); err != nil {
+			return buf[:offset], err
 		}
-		v = &r.none
-	done:
 		buf, err = v.AppendValue(buf)
 		if err != nil {
 			return buf[:offset], err
@@ -168,14 +367,12 @@ func (r *Replacer) replaceToken(buf []byte, token Token, values []Value) ([]byte
 	}
 	value = buf[offset:]
 	for len(filters) > 1 {
-		filters = filters[1:]
-		macro, filters = filters.split()
-		filter := r.filters[string(macro)]
-		if filter == nil {
-			return nil, &MissingFilterError{string(macro)}
-		}
+		macro, filters = splitFilter(filters[1:])
 		n := len(buf)
-		if buf, err = filter(buf, value); err != nil {
+		if buf, err = r.applyFilter(buf, value, macro); err != nil {
+			if _, missing := err.(*MissingFilterError); missing {
+				return nil, err
+			}
 			return buf[:offset], err
 		}
 		value = buf[n:]
@@ -184,6 +381,87 @@ func (r *Replacer) replaceToken(buf []byte, token Token, values []Value) ([]byte
 	return append(buf[:offset], value...), nil
 }
 
+func (r *Replacer) applyFilter(buf, value []byte, filter Token) ([]byte, error) {
+	name, arg, hasArg := filterArg(filter)
+	if hasArg {
+		if f := r.argFilter(name); f != nil {
+			return f(buf, value, arg)
+		}
+	} else if f := r.filter(name); f != nil {
+		return f(buf, value)
+	}
+	if f := r.valueFilter(name); f != nil {
+		v, err := f(String("", string(value)), arg)
+		if err != nil {
+			return buf, err
+		}
+		return v.AppendValue(buf)
+	}
+	return buf, &MissingFilterError{name}
+}
+
+// applyValueFilters applies leading value filters returning the remaining filters
+func (r *Replacer) applyValueFilters(v Value, filters Token) (Value, Token, error) {
+	for len(filters) > 1 {
+		filter, rest := splitFilter(filters[1:])
+		name, arg, hasArg := filterArg(filter)
+		f := r.valueFilters[name]
+		if f == nil {
+			// Registered byte filters override built-in value filters
+			if hasArg && r.argFilters[name] != nil || !hasArg && r.filters[name] != nil {
+				break
+			}
+			if f = defaultValueFilters[name]; f == nil {
+				break
+			}
+		}
+		var err error
+		if v, err = f(v, arg); err != nil {
+			return v, rest, err
+		}
+		filters = rest
+	}
+	return v, filters, nil
+}
+
+// filter resolves a filter by name.
+// Built-in filters are always available unless a filter with the same name is registered.
+func (r *Replacer) filter(name string) Filter {
+	if f := r.filters[name]; f != nil {
+		return f
+	}
+	return defaultFilters[name]
+}
+
+func (r *Replacer) argFilter(name string) ArgFilter {
+	if f := r.argFilters[name]; f != nil {
+		return f
+	}
+	return defaultArgFilters[name]
+}
+
+func (r *Replacer) valueFilter(name string) ValueFilter {
+	if f := r.valueFilters[name]; f != nil {
+		return f
+	}
+	return defaultValueFilters[name]
+}
+
+func (r *Replacer) lookup(macro Token, values []Value) (Value, bool) {
+	for i := range values {
+		v := &values[i]
+		if v.macro == macro {
+			return *v, true
+		}
+		if v.typ == typeSource {
+			if v, ok := v.any.(Source).Lookup(macro); ok {
+				return v, true
+			}
+		}
+	}
+	return Value{}, false
+}
+
 // ErrMacroNotFound is the error to return when a macro is not found
 var ErrMacroNotFound = errors.New("Macro not found")
 
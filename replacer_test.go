@@ -27,12 +27,48 @@ func TestParse(t *testing.T) {
 		config: *p,
 		chunks: []chunk{{
 			token: Token("foo:hex"),
+			raw:   "${foo:hex}",
 		}},
 		tail: " bar",
 	}
+	// The template config shares the maps of the Replacer without owning them
+	expect.config.owns = 0
 	if !reflect.DeepEqual(*tpl, expect) {
 		t.Errorf("Invalid parse %v", t)
 
 	}
 
 }
+
+func TestWith(t *testing.T) {
+	base := New(Filters{"hex": Hex}, Alias("PRICE", "price"), Skip("SKIP"))
+	child := base.With(Alias("PRICE", "AUCTION_PRICE"))
+	if reflect.ValueOf(child.filters).Pointer() != reflect.ValueOf(base.filters).Pointer() {
+		t.Errorf("Unmodified filters are not shared")
+	}
+	if reflect.ValueOf(child.alias).Pointer() == reflect.ValueOf(base.alias).Pointer() {
+		t.Errorf("Modified aliases are shared")
+	}
+	if len(base.alias) != 1 || len(child.alias) != 2 {
+		t.Errorf("Invalid aliases %v %v", base.alias, child.alias)
+	}
+	grandchild := child.With(Alias("PRICE", "P"), Filters{"b64": Base64})
+	if len(child.alias) != 2 || len(grandchild.alias) != 3 || len(child.filters) != 1 || len(grandchild.filters) != 2 {
+		t.Errorf("Invalid grandchild %v %v", grandchild.alias, grandchild.filters)
+	}
+	if buf, err := grandchild.Replace(nil, "${P:b64} ${AUCTION_PRICE:hex} ${SKIP}", String("PRICE", "1")); err != nil || string(buf) != "MQ== 31 ${SKIP}" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	if buf, err := base.Replace(nil, "${P} ${AUCTION_PRICE}", String("PRICE", "1"), String("P", "p"), String("AUCTION_PRICE", "a")); err != nil || string(buf) != "p a" {
+		t.Errorf("Parent modified %q %v", buf, err)
+	}
+}
+
+func TestHasFilter(t *testing.T) {
+	r := New(Filters{"hex": Hex})
+	for filter, expect := range map[string]bool{"hex": true, "hex(1)": false, "fixed(2)": true, "cents": true, "unix": true, "query": false} {
+		if r.HasFilter(filter) != expect {
+			t.Errorf("Invalid HasFilter(%q)", filter)
+		}
+	}
+}
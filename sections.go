@@ -0,0 +1,186 @@
+package macros
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Section markers prefix a macro token to open or close a section
+const (
+	// SectionIf opens a section rendered when the macro has a non-empty value
+	SectionIf = '?'
+	// SectionNot opens a section rendered when the macro is missing or empty
+	SectionNot = '^'
+	// SectionEach opens a section rendered once for each item of a list value
+	SectionEach = '*'
+	// SectionEnd closes a section
+	SectionEnd = '/'
+)
+
+type section struct {
+	kind   byte
+	chunks []chunk
+	tail   string
+	delim  int // index of the delimiter pair of the section end
+}
+
+func isSectionMarker(c byte) bool {
+	switch c {
+	case SectionIf, SectionNot, SectionEach, SectionEnd:
+		return true
+	}
+	return false
+}
+
+func isSectionToken(token Token) bool {
+	return len(token) > 0 && isSectionMarker(token[0])
+}
+
+// parseChunks parses chunks up to the end of the section closing `closing`
+func (r *Replacer) parseChunks(s string, closing Token) (chunks []chunk, tail string, rest string, delim int, err error) {
+	var chunk chunk
+	for len(s) > 0 {
+		if s, err = r.parseToken(s, &chunk); err != nil {
+			if err != errEOF {
+				return
+			}
+			break
+		}
+		if isIncludeToken(chunk.token) {
+			chunk.token = Token(Include) + Token(strings.TrimSpace(string(chunk.token[1:])))
+			chunks = append(chunks, chunk)
+			continue
+		}
+		if !isSectionToken(chunk.token) {
+			chunk.token = r.Alias(chunk.token)
+			chunks = append(chunks, chunk)
+			continue
+		}
+		kind := chunk.token[0]
+		macro, _ := r.Alias(Token(strings.TrimSpace(string(chunk.token[1:])))).split()
+		if macro == "" {
+			// An empty closing macro marks the top level
+			return nil, "", s, 0, fmt.Errorf("Empty section macro in %q", chunk.raw)
+		}
+		if kind == SectionEnd {
+			if closing == "" || macro != closing {
+				return nil, "", s, 0, fmt.Errorf("Unexpected section end %q", macro)
+			}
+			return chunks, chunk.prefix, s, chunk.delim, nil
+		}
+		body := section{kind: kind}
+		if body.chunks, body.tail, s, body.delim, err = r.parseChunks(s, macro); err != nil {
+			return
+		}
+		chunk.token = macro
+		chunk.section = &body
+		chunks = append(chunks, chunk)
+		chunk.section = nil
+	}
+	if closing != "" {
+		return nil, "", s, 0, fmt.Errorf("Unclosed section %q", closing)
+	}
+	return chunks, s, "", 0, nil
+}
+
+func (r *Replacer) render(buf []byte, chunks []chunk, tail string, values []Value) ([]byte, error) {
+	var err error
+	for i := range chunks {
+		chunk := &chunks[i]
+		buf = append(buf, chunk.prefix...)
+		if s := chunk.section; s != nil {
+			buf, err = r.renderSection(buf, chunk.token, s, values)
+		} else {
+			buf, err = r.replaceChunk(buf, chunk, values)
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+	return append(buf, tail...), nil
+}
+
+func (r *Replacer) renderSection(buf []byte, macro Token, s *section, values []Value) ([]byte, error) {
+	if s.kind == SectionEach {
+		return r.renderLoop(buf, macro, s, values)
+	}
+	ok := r.isPresent(buf, macro, values)
+	if s.kind == SectionNot {
+		ok = !ok
+	}
+	if ok {
+		return r.render(buf, s.chunks, s.tail, values)
+	}
+	return buf, nil
+}
+
+func (r *Replacer) renderLoop(buf []byte, macro Token, s *section, values []Value) ([]byte, error) {
+	v, ok := r.lookup(macro, values)
+	if !ok {
+		return buf, nil
+	}
+	var (
+		err         error
+		item, index = r.LoopMacros()
+		small       [loopScopeSize]Value
+		scope       = loopScope(small[:], values)
+	)
+	for i, n := 0, v.size(); i < n; i++ {
+		if i > 0 {
+			buf = append(buf, r.sep...)
+		}
+		scope[0] = v.item(item, i)
+		scope[1] = Int(index, i)
+		if buf, err = r.render(buf, s.chunks, s.tail, scope); err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+const loopScopeSize = 8
+
+// loopScope returns the values of a loop scope using `small` if it fits.
+// The first two values are reserved for the loop macros that shadow any outer values.
+func loopScope(small []Value, values []Value) []Value {
+	scope := small[:2]
+	if len(values)+2 > len(small) {
+		scope = make([]Value, 2, len(values)+2)
+	}
+	return append(scope, values...)
+}
+
+// isPresent checks if macro has a non-empty value using the spare capacity of buf as scratch space
+func (r *Replacer) isPresent(buf []byte, macro Token, values []Value) bool {
+	if _, ok := r.expand[macro]; !ok {
+		if _, ok := r.lookup(macro, values); !ok {
+			return false
+		}
+	}
+	offset := len(buf)
+	buf, err := r.replaceToken(buf, macro, values)
+	return err == nil && len(buf) > offset
+}
+
+func writeChunks(w *strings.Builder, chunks []chunk, tail string, pairs []DelimiterPair) {
+	for i := range chunks {
+		chunk := &chunks[i]
+		pair := &pairs[chunk.delim]
+		w.WriteString(chunk.prefix)
+		w.WriteString(pair.Start)
+		if s := chunk.section; s != nil {
+			w.WriteByte(s.kind)
+		}
+		w.WriteString(string(chunk.token))
+		w.WriteString(pair.End)
+		if s := chunk.section; s != nil {
+			writeChunks(w, s.chunks, s.tail, pairs)
+			pair = &pairs[s.delim]
+			w.WriteString(pair.Start)
+			w.WriteByte(SectionEnd)
+			w.WriteString(string(chunk.token))
+			w.WriteString(pair.End)
+		}
+	}
+	w.WriteString(tail)
+}
@@ -0,0 +1,122 @@
+package macros
+
+import "testing"
+
+func TestSections(t *testing.T) {
+	src := "http://example.org/?id=${ID}${?GDPR}&gdpr=${GDPR}${?CONSENT}&gdpr_consent=${CONSENT}${/CONSENT}${/GDPR}${^GDPR}&gdpr=0${/GDPR}"
+	tpl, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := tpl.String(); s != src {
+		t.Errorf("Invalid template %q", s)
+	}
+	for _, tc := range []struct {
+		Values []Value
+		Expect string
+	}{
+		{[]Value{String("ID", "1")}, "http://example.org/?id=1&gdpr=0"},
+		{[]Value{String("ID", "1"), String("GDPR", "")}, "http://example.org/?id=1&gdpr=0"},
+		{[]Value{String("ID", "1"), Int("GDPR", 1)}, "http://example.org/?id=1&gdpr=1"},
+		{[]Value{String("ID", "1"), Int("GDPR", 1), String("CONSENT", "abc")}, "http://example.org/?id=1&gdpr=1&gdpr_consent=abc"},
+	} {
+		buf, err := tpl.Replace(nil, tc.Values...)
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		} else if string(buf) != tc.Expect {
+			t.Errorf("Invalid replacement %q", buf)
+		}
+		buf, err = Replace(nil, src, tc.Values...)
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		} else if string(buf) != tc.Expect {
+			t.Errorf("Invalid replacement %q", buf)
+		}
+	}
+}
+
+func TestSectionsAlias(t *testing.T) {
+	r := New(Alias("gdpr", "GDPR"))
+	tpl, err := r.Parse("${?GDPR}gdpr=${GDPR}${/gdpr}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := tpl.Replace(nil, Bool("gdpr", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "gdpr=true" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+}
+
+func TestSectionsErrors(t *testing.T) {
+	for _, src := range []string{
+		"${?FOO}",
+		"${/FOO}",
+		"${?FOO}${/BAR}",
+		"${?FOO}${^BAR}${/FOO}",
+		"${?}abc",
+		"${*}x",
+		"${/}",
+		"${?FOO}${/ }",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("[%s] Expected parse error", src)
+		}
+	}
+	if buf, err := Replace(nil, "x${?}y"); err == nil {
+		t.Errorf("Expected error for empty section macro %q", buf)
+	}
+}
+
+func TestLoopSections(t *testing.T) {
+	src := "<Impressions>${*URLS}<Impression id=\"${#}\">${.}</Impression>${/URLS}</Impressions>"
+	tpl, err := Parse(src, LoopSeparator("\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := tpl.String(); s != src {
+		t.Errorf("Invalid template %q", s)
+	}
+	buf, err := tpl.Replace(nil, Concat("URLS", "", []string{"a", "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "<Impressions><Impression id=\"0\">a</Impression>\n<Impression id=\"1\">b</Impression></Impressions>"
+	if string(buf) != expect {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	buf, err = tpl.Replace(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "<Impressions></Impressions>" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+}
+
+func TestLoopMacros(t *testing.T) {
+	r := New(LoopMacros("PRICE", "N"), LoopSeparator("&"))
+	buf, err := r.Replace(nil, "${*PRICES}p${N}=${PRICE}${/PRICES}",
+		List("PRICES", Float64("", 0.5), Int("", 2)),
+		String("PRICE", "outer"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "p0=0.5&p1=2" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+}
+
+func TestReplaceSectionsAfterTokens(t *testing.T) {
+	r := New(Filters{"hex": Hex})
+	buf, err := r.Replace([]byte("> "), "${A:hex} ${B}${?C}c=${C}${/C}${D}", String("A", "a"), String("B", "b"), String("C", "1"), String("D", "d"))
+	if err != nil || string(buf) != "> 61 bc=1d" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+	if buf, err := r.Replace([]byte("> "), "${A} ${?C}${/D}", String("A", "a")); err == nil || string(buf) != "> " {
+		t.Errorf("Expected error %q %v", buf, err)
+	}
+}
@@ -0,0 +1,248 @@
+package macros
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Include is the marker of a token including a named template of a Set, e.g. `${>footer}`
+const Include = '>'
+
+func isIncludeToken(token Token) bool {
+	return len(token) > 0 && token[0] == Include
+}
+
+// Set is a concurrency-safe collection of named templates that can include each other.
+// Includes are resolved when templates are added so rendering has no extra cost.
+// Changes replace all templates atomically and failed changes keep the previous templates.
+type Set struct {
+	replacer *Replacer
+	mu       sync.Mutex // serializes changes
+	snapshot atomic.Value
+}
+
+// SetSnapshot is a read-only view of the templates of a Set at the time it was taken
+type SetSnapshot struct {
+	sources   map[string]string
+	templates map[string]*Template
+}
+
+// NewSet creates a new template set parsing templates with `r`
+func NewSet(r *Replacer) *Set {
+	if r == nil {
+		r = New()
+	}
+	s := Set{
+		replacer: r,
+	}
+	s.snapshot.Store(&SetSnapshot{})
+	return &s
+}
+
+func (s *Set) load() *SetSnapshot {
+	return s.snapshot.Load().(*SetSnapshot)
+}
+
+// Snapshot returns a read-only view of the current templates that later changes do not affect
+func (s *Set) Snapshot() *SetSnapshot {
+	return s.load()
+}
+
+// Lookup returns the template named `name` or nil
+func (s *Set) Lookup(name string) *Template {
+	return s.load().Lookup(name)
+}
+
+// Names returns the sorted names of the templates in the set
+func (s *Set) Names() []string {
+	return s.load().Names()
+}
+
+// Replace appends the template named `name` to `buf` replacing tokens with values
+func (s *Set) Replace(buf []byte, name string, values ...Value) ([]byte, error) {
+	return s.load().Replace(buf, name, values...)
+}
+
+// Lookup returns the template named `name` or nil
+func (s *SetSnapshot) Lookup(name string) *Template {
+	return s.templates[name]
+}
+
+// Names returns the sorted names of the templates in the snapshot
+func (s *SetSnapshot) Names() []string {
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Replace appends the template named `name` to `buf` replacing tokens with values
+func (s *SetSnapshot) Replace(buf []byte, name string, values ...Value) ([]byte, error) {
+	tpl := s.Lookup(name)
+	if tpl == nil {
+		return buf, fmt.Errorf("Template %q not found", name)
+	}
+	return tpl.Replace(buf, values...)
+}
+
+// Add adds or replaces the template named `name` recompiling the templates that include it
+func (s *Set) Add(name, src string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.load().sources
+	sources := make(map[string]string, len(prev)+1)
+	for name, src := range prev {
+		sources[name] = src
+	}
+	sources[name] = src
+	return s.store(sources, nil)
+}
+
+// Parse replaces all templates of the set with `sources` mapping names to template sources
+func (s *Set) Parse(sources map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := make(map[string]string, len(sources))
+	for name, src := range sources {
+		copied[name] = src
+	}
+	return s.store(copied, nil)
+}
+
+// ParseFS replaces all templates of the set with the files of `fsys` matching any of `patterns`.
+// Templates are named by their path in `fsys`.
+func (s *Set) ParseFS(fsys fs.FS, patterns ...string) error {
+	sources := make(map[string]string)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("Pattern %q matches no files", pattern)
+		}
+		for _, name := range matches {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			sources[name] = string(data)
+		}
+	}
+	return s.Parse(sources)
+}
+
+// store compiles `sources` using the templates in `parsed` instead of parsing their sources
+func (s *Set) store(sources map[string]string, parsed map[string]*Template) error {
+	c := setCompiler{
+		replacer:  s.replacer,
+		sources:   sources,
+		parsed:    parsed,
+		templates: make(map[string]*Template, len(sources)),
+	}
+	// Compile in order for deterministic errors
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := c.compile(name); err != nil {
+			return err
+		}
+	}
+	s.snapshot.Store(&SetSnapshot{
+		sources:   sources,
+		templates: c.templates,
+	})
+	return nil
+}
+
+type setCompiler struct {
+	replacer  *Replacer
+	sources   map[string]string
+	parsed    map[string]*Template
+	templates map[string]*Template
+	stack     []string
+}
+
+func (c *setCompiler) compile(name string) (*Template, error) {
+	if t, ok := c.templates[name]; ok {
+		return t, nil
+	}
+	for i, n := range c.stack {
+		if n == name {
+			return nil, includeCycleError(append(c.stack[i:], name))
+		}
+	}
+	src, ok := c.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("Template %q not found", name)
+	}
+	t := c.parsed[name]
+	if t == nil {
+		var err error
+		if t, err = c.replacer.Parse(src); err != nil {
+			return nil, fmt.Errorf("Template %q: %s", name, err)
+		}
+	}
+	c.stack = append(c.stack, name)
+	var p partialBuilder
+	err := c.inline(&p, t.chunks, t.tail)
+	c.stack = c.stack[:len(c.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+	t.chunks, t.tail = p.chunks, string(p.text)
+	c.templates[name] = t
+	return t, nil
+}
+
+// inline replaces include tokens with the chunks of the included templates
+func (c *setCompiler) inline(p *partialBuilder, chunks []chunk, tail string) error {
+	for i := range chunks {
+		chunk := chunks[i]
+		p.text = append(p.text, chunk.prefix...)
+		if s := chunk.section; s != nil {
+			var body partialBuilder
+			if err := c.inline(&body, s.chunks, s.tail); err != nil {
+				return err
+			}
+			chunk.section = &section{
+				kind:   s.kind,
+				chunks: body.chunks,
+				tail:   string(body.text),
+				delim:  s.delim,
+			}
+		} else if isIncludeToken(chunk.token) {
+			included, err := c.compile(string(chunk.token[1:]))
+			if err != nil {
+				return err
+			}
+			for _, inc := range included.chunks {
+				p.text = append(p.text, inc.prefix...)
+				p.add(inc)
+			}
+			p.text = append(p.text, included.tail...)
+			continue
+		}
+		p.add(chunk)
+	}
+	p.text = append(p.text, tail...)
+	return nil
+}
+
+func includeCycleError(names []string) error {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return fmt.Errorf("Include cycle %s", strings.Join(quoted, " > "))
+}
@@ -0,0 +1,113 @@
+package macros
+
+import (
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSet(t *testing.T) {
+	s := NewSet(New(Filters{"hex": Hex}))
+	err := s.Parse(map[string]string{
+		"wrapper":  "<VAST>${> trackers}${?CLICK}<Click>${CLICK}</Click>${/CLICK}</VAST>",
+		"trackers": "<Impression>${IMP:hex}</Impression>${>error}",
+		"error":    "<Error>${ERR}</Error>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := s.Replace(nil, "wrapper", String("IMP", "1"), String("ERR", "e"), String("CLICK", "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "<VAST><Impression>31</Impression><Error>e</Error><Click>c</Click></VAST>" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if names := s.Names(); len(names) != 3 || names[0] != "error" {
+		t.Errorf("Invalid names %q", names)
+	}
+	if err := s.Add("error", "<Error>${ERR:hex}</Error>"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := s.Replace(nil, "wrapper", String("IMP", "1"), String("ERR", "e")); string(buf) != "<VAST><Impression>31</Impression><Error>65</Error></VAST>" {
+		t.Errorf("Invalid replacement after add %q", buf)
+	}
+	if _, err := s.Replace(nil, "foo"); err == nil {
+		t.Errorf("Expected missing template error")
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	s := NewSet(nil)
+	if err := s.Add("a", "a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		Sources map[string]string
+		Expect  string
+	}{
+		{map[string]string{"a": "${>b}", "b": "${>c}", "c": "${>b}"}, `Include cycle "b" > "c" > "b"`},
+		{map[string]string{"a": "${>a}"}, `Include cycle "a" > "a"`},
+		{map[string]string{"a": "${>b}"}, `Template "b" not found`},
+		{map[string]string{"a": "${?A}"}, `Template "a": Unclosed section "A"`},
+	} {
+		if err := s.Parse(tc.Sources); err == nil || err.Error() != tc.Expect {
+			t.Errorf("Invalid error %v", err)
+		}
+	}
+	if s.Lookup("a") == nil || s.Lookup("a").String() != "a" {
+		t.Errorf("Failed parse replaced templates")
+	}
+}
+
+func TestSetParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"vast/wrapper.xml": {Data: []byte("<VAST>${>vast/tracker.xml}</VAST>")},
+		"vast/tracker.xml": {Data: []byte("<Impression>${IMP}</Impression>")},
+		"vast/README":      {Data: []byte("${>foo}")},
+	}
+	s := NewSet(nil)
+	if err := s.ParseFS(fsys, "vast/*.xml"); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				buf, err := s.Replace(nil, "vast/wrapper.xml", String("IMP", "i"))
+				if err != nil || string(buf) != "<VAST><Impression>i</Impression></VAST>" {
+					t.Errorf("Invalid replacement %q %v", buf, err)
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 10; j++ {
+		if err := s.ParseFS(fsys, "vast/*.xml"); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Wait()
+	if err := s.ParseFS(fsys, "*.json"); err == nil {
+		t.Errorf("Expected no match error")
+	}
+}
+
+func TestSetSnapshot(t *testing.T) {
+	s := NewSet(nil)
+	if err := s.Add("a", "a=${A}"); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := s.Snapshot()
+	if err := s.Add("b", "b=${>a}"); err != nil {
+		t.Fatal(err)
+	}
+	if names := snapshot.Names(); len(names) != 1 || names[0] != "a" {
+		t.Errorf("Snapshot modified %q", names)
+	}
+	if buf, err := s.Snapshot().Replace(nil, "b", String("A", "1")); err != nil || string(buf) != "b=a=1" {
+		t.Errorf("Invalid replacement %q %v", buf, err)
+	}
+}
@@ -0,0 +1,88 @@
+package macros
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShellSyntax enables `os.Expand` compatible syntax.
+// Macros can be written as `$VAR` or `${VAR}` and shell-style `${VAR:-default}` and `${VAR:?error}` forms are supported.
+// Filters use the `:` separator as usual so filter names cannot start with `-` or `?`.
+func ShellSyntax() Option {
+	return optionFunc(func(p *Replacer) {
+		p.start, p.end = DefaultDelimiters()
+		p.pairs = nil
+		p.shell = true
+	})
+}
+
+// parseShellToken parses `$VAR` and `${VAR}` tokens
+func (r *Replacer) parseShellToken(s string, chunk *chunk) (string, error) {
+	for offset := 0; offset < len(s); {
+		i := strings.IndexByte(s[offset:], '$')
+		if i == -1 {
+			break
+		}
+		i += offset
+		rest := s[i+1:]
+		if strings.HasPrefix(rest, "{") {
+			chunk.delim = 0
+			return parseDelimited(s, i, defaultStartDelimiter, defaultEndDelimiter, chunk)
+		}
+		if n := shellNameLen(rest); n > 0 {
+			chunk.prefix = s[:i]
+			chunk.token = Token(rest[:n])
+			chunk.raw = s[i : i+1+n]
+			return rest[n:], nil
+		}
+		offset = i + 1
+	}
+	return s, errEOF
+}
+
+// shellNameLen returns the length of a variable name following `os.Expand` rules.
+// Special variables `$?` and `$*` are not supported as they collide with section markers.
+func shellNameLen(s string) int {
+	if len(s) == 0 {
+		return 0
+	}
+	switch c := s[0]; c {
+	case '#', '$', '@', '!', '-':
+		return 1
+	default:
+		if '0' <= c && c <= '9' {
+			return 1
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// shellOp returns the shell operator and argument of a token's filters
+func shellOp(filters Token) (op byte, arg string) {
+	if len(filters) > 1 && filters[0] == TokenDelimiter {
+		switch filters[1] {
+		case '-', '?':
+			return filters[1], string(filters[2:])
+		}
+	}
+	return 0, ""
+}
+
+func (r *Replacer) replaceShellToken(buf []byte, macro Token, op byte, arg string, values []Value) ([]byte, error) {
+	if r.isPresent(buf, macro, values) {
+		return r.replaceToken(buf, macro, values)
+	}
+	if op == '-' {
+		return append(buf, arg...), nil
+	}
+	if arg == "" {
+		arg = "parameter null or not set"
+	}
+	return buf, fmt.Errorf("%s: %s", macro, arg)
+}
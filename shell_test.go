@@ -0,0 +1,54 @@
+package macros
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("MACROS_TEST_FOO", "foo")
+	buf, err := Replace(nil, "${MACROS_TEST_FOO} ${BAR}", String("BAR", "bar"), Env())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "foo bar" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if _, err := Replace(nil, "${MACROS_TEST_BAR}", Env()); err != ErrMacroNotFound {
+		t.Errorf("Invalid error %v", err)
+	}
+}
+
+func TestShellSyntax(t *testing.T) {
+	t.Setenv("MACROS_TEST_FOO", "foo")
+	t.Setenv("MACROS_TEST_EMPTY", "")
+	r := New(ShellSyntax(), Filters{"hex": Hex}, DefaultValue(""))
+	for _, src := range []string{
+		"$MACROS_TEST_FOO/${MACROS_TEST_FOO}.$MACROS_TEST_FOO-bar $ $$ $12 100$",
+		"${MACROS_TEST_EMPTY}x$MACROS_TEST_MISSING",
+	} {
+		buf, err := r.Replace(nil, src, Env())
+		if err != nil {
+			t.Errorf("Unexpected error %s", err)
+		} else if expect := os.ExpandEnv(src); string(buf) != expect {
+			t.Errorf("Invalid replacement %q != %q", buf, expect)
+		}
+	}
+	tpl, err := r.Parse("${MACROS_TEST_FOO:hex} ${MACROS_TEST_EMPTY:-bar} ${MACROS_TEST_MISSING:-baz} ${MACROS_TEST_FOO:-baz}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := tpl.Replace(nil, Env())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "666f6f bar baz foo" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if _, err := r.Replace(nil, "${MACROS_TEST_MISSING:?missing}", Env()); err == nil || err.Error() != "MACROS_TEST_MISSING: missing" {
+		t.Errorf("Invalid error %v", err)
+	}
+	if _, err := r.Replace(nil, "${MACROS_TEST_EMPTY:?}", Env()); err == nil || err.Error() != "MACROS_TEST_EMPTY: parameter null or not set" {
+		t.Errorf("Invalid error %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package macros
+
+import (
+	"strings"
+)
+
+// filterSize returns the size reserved for the output of a filter for `n` bytes of input.
+// Filters are not executed so value filters are bounded the same way as byte filters.
+// None of the built-in filters produce more than `max(3n, 3*len(arg), 64)` bytes
+// except `fixed` and `exp` with a precision above 60 and arithmetic on floats with more than 64 digits.
+func filterSize(n int, filter Token) int {
+	_, arg, _ := filterArg(filter)
+	if len(arg) > n {
+		n = len(arg)
+	}
+	if n *= 3; n < minBufferSize {
+		return minBufferSize
+	}
+	return n
+}
+
+// EstimateSizeFor computes a hint for the rendered size of a template for `values`.
+// It is an upper bound for the built-in filters and values with the exceptions noted for `filterSize`,
+// `Any` values other than strings and `Bind` values. Filters registered as options are assumed to behave like the built-in ones.
+func (t *Template) EstimateSizeFor(values ...Value) int {
+	return t.config.estimateSize(t.chunks, t.tail, values)
+}
+
+func (r *Replacer) estimateSize(chunks []chunk, tail string, values []Value) int {
+	n := len(tail)
+	for i := range chunks {
+		chunk := &chunks[i]
+		n += len(chunk.prefix)
+		if s := chunk.section; s != nil {
+			n += r.estimateSectionSize(chunk.token, s, values)
+		} else {
+			n += r.estimateChunkSize(chunk, values)
+		}
+	}
+	return n
+}
+
+func (r *Replacer) estimateSectionSize(macro Token, s *section, values []Value) int {
+	if s.kind != SectionEach {
+		return r.estimateSize(s.chunks, s.tail, values)
+	}
+	v, ok := r.lookup(macro, values)
+	if !ok {
+		return 0
+	}
+	var (
+		item, index = r.LoopMacros()
+		small       [loopScopeSize]Value
+		scope       = loopScope(small[:], values)
+		n           = len(r.sep) * v.size()
+	)
+	for i, size := 0, v.size(); i < size; i++ {
+		scope[0] = v.item(item, i)
+		scope[1] = Int(index, i)
+		n += r.estimateSize(s.chunks, s.tail, scope)
+	}
+	return n
+}
+
+func (r *Replacer) estimateChunkSize(c *chunk, values []Value) int {
+	if c.raw != "" && r.skipped(c.token) {
+		return len(c.raw)
+	}
+	return r.estimateTokenSize(c.token, values)
+}
+
+// estimateTokenSize estimates the size of a token including the scratch space used by filters
+func (r *Replacer) estimateTokenSize(token Token, values []Value) int {
+	macro, filters := token.split()
+	if alias, ok := r.alias[macro]; ok {
+		macro = alias
+	}
+	if r.skipped(macro) {
+		start, end := r.Delimiters()
+		return len(start) + len(token) + len(end)
+	}
+	var size int
+	if r.shell {
+		if op, arg := shellOp(filters); op != 0 {
+			size = r.estimateTokenSize(macro, values)
+			if len(arg) > size {
+				size = len(arg)
+			}
+			return size
+		}
+	}
+	if exp, ok := r.expand[macro]; ok {
+		// Assume each token in the expansion can be any of the values
+		start, _ := r.Delimiters()
+		var max int
+		for i := range values {
+			if n := values[i].sizeHint(); n > max {
+				max = n
+			}
+		}
+		size = len(exp) + max*strings.Count(exp, start)
+	} else if v, ok := r.lookup(macro, values); ok {
+		size = v.sizeHint()
+	} else {
+		size = r.none.sizeHint()
+	}
+	total := size
+	for len(filters) > 1 {
+		var filter Token
+		filter, filters = splitFilter(filters[1:])
+		size = filterSize(size, filter)
+		total += size
+	}
+	return total
+}
@@ -0,0 +1,69 @@
+package macros
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateSizeFor(t *testing.T) {
+	tpl := Must("?id=${ID:urlquery}&h=${ID:hex}&p=${PRICE}&ts=${TS}${?GDPR}&gdpr=${GDPR}${/GDPR}${*URLS}&u=${.:base64}${/URLS}&${FOO}", Filters{
+		"urlquery": QueryEscape,
+		"hex":      Hex,
+		"base64":   Base64,
+	}, Skip("FOO"))
+	values := []Value{
+		String("ID", "foo bar/baz"),
+		Float64("PRICE", 1e21),
+		Time("TS", time.Now(), time.RFC3339Nano),
+		Bool("GDPR", true),
+		Concat("URLS", "", []string{"a", "bb", "ccc"}),
+	}
+	size := tpl.EstimateSizeFor(values...)
+	buf, err := tpl.Replace(nil, values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size < len(buf) {
+		t.Errorf("Invalid size estimation %d < %d", size, len(buf))
+	}
+	if cap(buf) != size {
+		t.Errorf("Invalid preallocation %d != %d", cap(buf), size)
+	}
+	if size := Must("${A}${B}").EstimateSizeFor(String("A", "foo"), Int("B", 42)); size != 23 {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+}
+
+func TestReplacePreallocates(t *testing.T) {
+	tpl := Must("?id=${ID:hex}&price=${PRICE}&ts=${TS}", Filters{"hex": Hex})
+	now := time.Now()
+	allocs := testing.AllocsPerRun(100, func() {
+		tpl.Replace(nil, String("ID", "foo bar baz"), Float64("PRICE", 4.2), Time("TS", now, time.RFC3339Nano))
+	})
+	if allocs != 1 {
+		t.Errorf("Replace allocates %f times per run", allocs)
+	}
+}
+
+func TestReplaceEstimatesOnlyWhenNeeded(t *testing.T) {
+	calls := 0
+	tpl := Must("${N:count}", ValueFilters{
+		"count": func(v Value, _ string) (Value, error) {
+			calls++
+			return v, nil
+		},
+	})
+	if _, err := tpl.Replace(make([]byte, 0, 1024), Int("N", 1)); err != nil || calls != 1 {
+		t.Errorf("Invalid value filter calls %d %v", calls, err)
+	}
+	// Value filters are not executed to estimate the size
+	calls = 0
+	if _, err := tpl.Replace(nil, Int("N", 1)); err != nil || calls != 1 {
+		t.Errorf("Invalid value filter calls %d %v", calls, err)
+	}
+	long := strings.Repeat("x", 100)
+	if size := Must("${A}").EstimateSizeFor(Any("A", long)); size < len(long) {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+}
@@ -2,9 +2,12 @@ package macros
 
 import (
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// Template is a compiled template
+// Template is a compiled template.
+// A Template is immutable and safe for concurrent use.
 type Template struct {
 	chunks []chunk
 	tail   string
@@ -14,28 +17,32 @@ type Template struct {
 // String renders a template
 func (t *Template) String() string {
 	var w strings.Builder
-	start, end := t.config.Delimiters()
-	for i := range t.chunks {
-		chunk := &t.chunks[i]
-		w.WriteString(chunk.prefix)
-		macro, filters := chunk.token.split()
-		if alias, ok := t.config.alias[macro]; ok {
-			macro = alias
-		}
-		w.WriteString(start)
-		w.WriteString(string(macro))
-		if filters != "" {
-			w.WriteString(string(filters))
-		}
-		w.WriteString(end)
-	}
-	w.WriteString(t.tail)
+	writeChunks(&w, t.chunks, t.tail, t.config.DelimiterPairs())
 	return w.String()
 }
 
 type chunk struct {
-	prefix string
-	token  Token
+	prefix  string
+	token   Token
+	section *section
+	delim   int    // index of the delimiter pair
+	raw     string // original token text including delimiters
+}
+
+// Tokens returns the tokens of a template in order including section macros
+func (t *Template) Tokens() []Token {
+	return appendTokens(nil, t.chunks)
+}
+
+func appendTokens(tokens []Token, chunks []chunk) []Token {
+	for i := range chunks {
+		chunk := &chunks[i]
+		tokens = append(tokens, chunk.token)
+		if s := chunk.section; s != nil {
+			tokens = appendTokens(tokens, s.chunks)
+		}
+	}
+	return tokens
 }
 
 // Must creates a new templates or panics if there were any errors
@@ -59,28 +66,81 @@ func Parse(tpl string, options ...Option) (*Template, error) {
 
 // EstimateSize estimates the rendered buffer size
 func (t *Template) EstimateSize(size int) int {
-	size *= len(t.chunks)
-	for i := range t.chunks {
-		chunk := &t.chunks[i]
-		size += len(chunk.prefix)
+	return estimateSize(t.chunks, t.tail, size)
+}
+
+func estimateSize(chunks []chunk, tail string, size int) int {
+	n := size * len(chunks)
+	for i := range chunks {
+		chunk := &chunks[i]
+		n += len(chunk.prefix)
+		if s := chunk.section; s != nil {
+			n += estimateSize(s.chunks, s.tail, size)
+		}
 	}
-	size += len(t.tail)
-	return size
+	return n + len(tail)
 }
 
 // Replace executes a template appending it to a buffer
-func (t *Template) Replace(b []byte, values ...Value) (buf []byte, err error) {
-	buf = b
-	for i := range t.chunks {
-		chunk := &t.chunks[i]
-		buf = append(buf, chunk.prefix...)
-		if buf, err = t.config.replaceToken(buf, chunk.token, values); err != nil {
-			return b, err
+func (t *Template) Replace(b []byte, values ...Value) ([]byte, error) {
+	buf := b
+	// Estimating formats values so it is skipped if the buffer has room for the static estimate
+	if spare := cap(buf) - len(buf); spare < t.EstimateSize(minBufferSize) {
+		if size := t.EstimateSizeFor(values...); spare < size {
+			buf = make([]byte, len(b), len(b)+size)
+			copy(buf, b)
+		}
+	}
+	buf, err := t.config.render(buf, t.chunks, t.tail, values)
+	if err != nil {
+		return b, err
+	}
+	return buf, nil
+}
+
+// Render executes a template using a pooled buffer.
+// The returned buffer is valid until `release` is called, calling `release` more than once has no effect.
+// The release function is the only allocation, use `Replace` with a reused buffer to render without allocating.
+func (t *Template) Render(values ...Value) (buf []byte, release func(), err error) {
+	b := getRenderBuffer()
+	if size := t.EstimateSize(minBufferSize); cap(b.buf) < size {
+		b.buf = make([]byte, 0, size)
+	}
+	if b.buf, err = t.Replace(b.buf[:0], values...); err != nil {
+		b.put()
+		return nil, noRelease, err
+	}
+	// Each call gets its own release bound to the current hand out of the buffer
+	// so that a stale release cannot return the buffer after it is reused
+	gen := b.gen.Load()
+	return b.buf, func() {
+		if b.gen.CompareAndSwap(gen, gen+1) {
+			b.put()
 		}
+	}, nil
+}
+
+type renderBuffer struct {
+	buf []byte
+	gen atomic.Uint64 // incremented each time the buffer is released
+}
+
+var renderBuffers sync.Pool
+
+func getRenderBuffer() *renderBuffer {
+	if b, ok := renderBuffers.Get().(*renderBuffer); ok {
+		return b
 	}
-	return append(buf, t.tail...), nil
+	return &renderBuffer{}
+}
+
+func (b *renderBuffer) put() {
+	b.buf = b.buf[:0]
+	renderBuffers.Put(b)
 }
 
+func noRelease() {}
+
 // // Execute writes a template to `w` replacing macros with `values` using `buffer` as scratch space.
 // func (t *Template) Execute(w io.Writer, buffer []byte, values ...Value) (n int64, err error) {
 // 	if buffer == nil {
@@ -110,17 +170,6 @@ func (t *Template) Replace(b []byte, values ...Value) (buf []byte, err error) {
 // }
 
 func (t *Template) parse(s string) (err error) {
-	var chunk chunk
-	for len(s) > 0 {
-		if s, err = t.config.parseToken(s, &chunk); err != nil {
-			if err == errEOF {
-				t.tail = s
-				err = nil
-			}
-			return
-		}
-		chunk.token = t.config.Alias(chunk.token)
-		t.chunks = append(t.chunks, chunk)
-	}
+	t.chunks, t.tail, _, _, err = t.config.parseChunks(s, "")
 	return
 }
@@ -70,3 +70,45 @@ func TestURLTemplate(t *testing.T) {
 		t.Errorf("Invalid url %s != %s", tpl, expect)
 	}
 }
+
+func TestTemplateTokens(t *testing.T) {
+	tpl := Must("${FOO:hex} ${?BAR}${BAZ}${/BAR} ${FOO}")
+	tokens := tpl.Tokens()
+	expect := []Token{"FOO:hex", "BAR", "BAZ", "FOO"}
+	if len(tokens) != len(expect) {
+		t.Fatalf("Invalid tokens %v", tokens)
+	}
+	for i := range expect {
+		if tokens[i] != expect[i] {
+			t.Errorf("Invalid token %q != %q", tokens[i], expect[i])
+		}
+	}
+}
+
+func TestRenderReleaseTwice(t *testing.T) {
+	tpl := Must("${A}")
+	buf, release, err := tpl.Render(String("A", "a"))
+	if err != nil || string(buf) != "a" {
+		t.Fatalf("Invalid render %q %v", buf, err)
+	}
+	release()
+	release()
+	a, releaseA, _ := tpl.Render(String("A", "a"))
+	b, releaseB, _ := tpl.Render(String("A", "b"))
+	defer releaseA()
+	defer releaseB()
+	if string(a) != "a" || string(b) != "b" {
+		t.Errorf("Shared render buffer %q %q", a, b)
+	}
+	// A stale release must not return a buffer handed out to another render
+	c, releaseC, _ := tpl.Render(String("A", "c"))
+	releaseC()
+	d, releaseD, _ := tpl.Render(String("A", "d"))
+	defer releaseD()
+	releaseC()
+	e, releaseE, _ := tpl.Render(String("A", "e"))
+	defer releaseE()
+	if string(d) != "d" || string(e) != "e" || &d[0] == &e[0] {
+		t.Errorf("Shared render buffer %q %q %q", c, d, e)
+	}
+}
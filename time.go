@@ -0,0 +1,82 @@
+package macros
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errNotTime = errors.New("Value is not a time")
+
+func timeFilter(convert func(v *Value, tm time.Time, arg string) (Value, error)) ValueFilter {
+	return func(v Value, arg string) (Value, error) {
+		tm, ok := v.Time()
+		if !ok {
+			return v, errNotTime
+		}
+		return convert(&v, tm, arg)
+	}
+}
+
+// TZ is a value filter converting a time value to the location named `arg`, e.g. `${TS:tz(UTC)}`
+var TZ = timeFilter(func(v *Value, tm time.Time, arg string) (Value, error) {
+	loc, err := loadLocation(arg)
+	if err != nil {
+		return *v, err
+	}
+	return Time(v.macro, tm.In(loc), v.str), nil
+})
+
+// UTC is a value filter converting a time value to UTC
+var UTC = timeFilter(func(v *Value, tm time.Time, _ string) (Value, error) {
+	return Time(v.macro, tm.UTC(), v.str), nil
+})
+
+// Format is a value filter setting the layout of a time value, e.g. `${TS:format(2006-01-02)}`
+var Format = timeFilter(func(v *Value, tm time.Time, layout string) (Value, error) {
+	return Time(v.macro, tm, layout), nil
+})
+
+// RFC3339 is a value filter formatting a time value as RFC3339
+var RFC3339 = timeFilter(func(v *Value, tm time.Time, _ string) (Value, error) {
+	return Time(v.macro, tm, time.RFC3339), nil
+})
+
+// RFC3339Nano is a value filter formatting a time value as RFC3339 with nanoseconds
+var RFC3339Nano = timeFilter(func(v *Value, tm time.Time, _ string) (Value, error) {
+	return Time(v.macro, tm, time.RFC3339Nano), nil
+})
+
+// UnixTime is a value filter converting a time value to a unix timestamp in seconds
+var UnixTime = timeFilter(func(v *Value, tm time.Time, _ string) (Value, error) {
+	return Int64(v.macro, tm.Unix()), nil
+})
+
+// UnixMilli is a value filter converting a time value to a unix timestamp in milliseconds
+var UnixMilli = timeFilter(func(v *Value, tm time.Time, _ string) (Value, error) {
+	return Int64(v.macro, tm.UnixMilli()), nil
+})
+
+// UnixNano is a value filter converting a time value to a unix timestamp in nanoseconds.
+// Times outside the range of an int64 in nanoseconds (years 1678 to 2262) are an error.
+var UnixNano = timeFilter(func(v *Value, tm time.Time, _ string) (Value, error) {
+	if tm.Before(minUnixNano) || tm.After(maxUnixNano) {
+		return *v, errOverflow
+	}
+	return Int64(v.macro, tm.UnixNano()), nil
+})
+
+var locations sync.Map
+
+// loadLocation caches locations to avoid loading them on each render
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
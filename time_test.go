@@ -0,0 +1,56 @@
+package macros
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTimeFilters(t *testing.T) {
+	loc := time.FixedZone("EET", 2*3600)
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 123456789, loc)
+	tpl := Must("${TS} ${TS:utc} ${TS:unix} ${TS:unixms} ${TS:unixnano} ${TS:rfc3339} ${TS:tz(UTC):format(2006-01-02 15:04)} ${TS:format(15:04):hex}",
+		Filters{"hex": Hex})
+	values := []Value{Time("TS", tm, time.Kitchen)}
+	buf, err := tpl.Replace(nil, values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "3:04AM 1:04AM 1577927045 1577927045123 1577927045123456789 2020-01-02T03:04:05+02:00 2020-01-02 01:04 30333a3034"
+	if string(buf) != expect {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if size := tpl.EstimateSizeFor(values...); size < len(buf) {
+		t.Errorf("Invalid size estimation %d", size)
+	}
+	if _, err := tpl.Replace(nil, String("TS", "foo")); err == nil {
+		t.Errorf("Expected missing filter error")
+	}
+	if _, err := Replace(nil, "${TS:tz(Foo/Bar)}", Time("TS", tm, "")); err == nil {
+		t.Errorf("Expected location error")
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	for _, tm := range []time.Time{
+		{},
+		time.Date(2300, 1, 2, 3, 4, 5, 6, time.UTC),
+		time.Date(1600, 1, 2, 3, 4, 5, 6, time.FixedZone("X", 3600)),
+	} {
+		buf, err := Replace(nil, "${T} ${T:add(1h)}", Time("T", tm, time.RFC3339Nano))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := tm.Format(time.RFC3339Nano) + " " + tm.Add(time.Hour).Format(time.RFC3339Nano)
+		if string(buf) != expect {
+			t.Errorf("Invalid replacement %q != %q", buf, expect)
+		}
+		buf, err = Replace(nil, "${T:unix} ${T:unixms}", Time("T", tm, ""))
+		if expect := fmt.Sprintf("%d %d", tm.Unix(), tm.UnixMilli()); err != nil || string(buf) != expect {
+			t.Errorf("Invalid timestamps %q != %q %v", buf, expect, err)
+		}
+		if _, err := Replace(nil, "${T:unixnano}", Time("T", tm, "")); err != errOverflow {
+			t.Errorf("Expected overflow error %v", err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package macros
+
+import "fmt"
+
+// Translate rewrites a parsed template to the dialect of `to` renaming macros using `mapping`.
+// Macros are mapped after resolving aliases of the template and the result resolves aliases of `to`.
+// Loop macros are mapped to the loop macros of `to` unless explicitly mapped.
+// Filters are kept as is and macros without a mapping are an error.
+func Translate(tpl *Template, to *Replacer, mapping map[Token]Token) (*Template, error) {
+	t := Template{
+		tail:   tpl.tail,
+		config: *to.clone(),
+	}
+	tr := translator{
+		mapping: mapping,
+		from:    &tpl.config,
+		to:      to,
+	}
+	var err error
+	if t.chunks, err = tr.translate(tpl.chunks, false); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+type translator struct {
+	mapping map[Token]Token
+	from    *Replacer
+	to      *Replacer
+}
+
+func (tr *translator) translate(chunks []chunk, loop bool) ([]chunk, error) {
+	out := make([]chunk, len(chunks))
+	for i := range chunks {
+		c := chunks[i]
+		macro, filters := c.token.split()
+		target, err := tr.macro(macro, loop)
+		if err != nil {
+			return nil, err
+		}
+		c.token = tr.to.Alias(target + filters)
+		c.delim = 0
+		c.raw = ""
+		if s := c.section; s != nil {
+			body := section{
+				kind: s.kind,
+				tail: s.tail,
+			}
+			if body.chunks, err = tr.translate(s.chunks, loop || s.kind == SectionEach); err != nil {
+				return nil, err
+			}
+			c.section = &body
+		}
+		out[i] = c
+	}
+	return out, nil
+}
+
+func (tr *translator) macro(macro Token, loop bool) (Token, error) {
+	if target, ok := tr.mapping[macro]; ok {
+		return target, nil
+	}
+	if loop {
+		item, index := tr.from.LoopMacros()
+		toItem, toIndex := tr.to.LoopMacros()
+		switch macro {
+		case item:
+			return toItem, nil
+		case index:
+			return toIndex, nil
+		}
+	}
+	return "", fmt.Errorf("No mapping for macro %q", macro)
+}
@@ -0,0 +1,33 @@
+package macros
+
+import "testing"
+
+func TestTranslate(t *testing.T) {
+	tpl := Must("http://example.org/win?p=${PRICE:hex}&id=${BID_ID}${*ITEMS}&i=${.}${/ITEMS}",
+		Alias("AUCTION_PRICE", "PRICE"), Filters{"hex": Hex})
+	to := New(Delimiters("%%", "%%"), Alias("WINNING_PRICE", "WP"), LoopMacros("ITEM", "INDEX"), Filters{"hex": Hex})
+	out, err := Translate(tpl, to, map[Token]Token{
+		"AUCTION_PRICE": "WP",
+		"BID_ID":        "BID",
+		"ITEMS":         "LIST",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); s != "http://example.org/win?p=%%WINNING_PRICE:hex%%&id=%%BID%%%%*LIST%%&i=%%ITEM%%%%/LIST%%" {
+		t.Errorf("Invalid translation %q", s)
+	}
+	buf, err := out.Replace(nil, String("WINNING_PRICE", "1"), String("BID", "b"), List("LIST", String("", "x"), String("", "y")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "http://example.org/win?p=31&id=b&i=x&i=y" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	if s := tpl.String(); s != "http://example.org/win?p=${AUCTION_PRICE:hex}&id=${BID_ID}${*ITEMS}&i=${.}${/ITEMS}" {
+		t.Errorf("Source template modified %q", s)
+	}
+	if _, err := Translate(tpl, to, map[Token]Token{"AUCTION_PRICE": "WP"}); err == nil {
+		t.Errorf("Expected missing mapping error")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"strconv"
 	"time"
 )
@@ -23,11 +24,14 @@ const (
 	typeNone valueType = iota
 	typeString
 	typeFloat
+	typeFloat32
 	typeInt
 	typeUint
 	typeAny
 	typeTime
 	typeConcat
+	typeList
+	typeSource
 )
 
 // String creates a new value replacing `macro` with a string
@@ -40,6 +44,36 @@ func Concat(macro Token, sep string, values []string) Value {
 	return Value{macro, sep, 0, typeConcat, values}
 }
 
+// List creates a new value replacing `macro` with a list of values.
+// Loop sections render once for each of the items, otherwise items are joined with commas.
+func List(macro Token, items ...Value) Value {
+	return Value{macro, "", 0, typeList, items}
+}
+
+// Source looks up values by macro
+type Source interface {
+	Lookup(macro Token) (Value, bool)
+}
+
+// FromSource creates a new value that replaces any macro found in `src`
+func FromSource(src Source) Value {
+	return Value{"", "", 0, typeSource, src}
+}
+
+// Env creates a new value that replaces macros with environment variables
+func Env() Value {
+	return FromSource(envSource{})
+}
+
+type envSource struct{}
+
+func (envSource) Lookup(macro Token) (Value, bool) {
+	if v, ok := os.LookupEnv(string(macro)); ok {
+		return String(macro, v), true
+	}
+	return Value{}, false
+}
+
 // Bool creates a new value replacing `macro` with "true" or "false"
 func Bool(macro Token, v bool) Value {
 	if v {
@@ -55,7 +89,7 @@ func Float64(macro Token, f float64) Value {
 
 // Float32 creates a new value replacing `macro` with a float32 value
 func Float32(macro Token, f float32) Value {
-	return Value{macro, "", math.Float64bits(float64(f)), typeFloat, nil}
+	return Value{macro, "", math.Float64bits(float64(f)), typeFloat32, nil}
 }
 
 // Uint creates a new value that replaces `macro` with a `uint`
@@ -113,11 +147,21 @@ func Unix(macro Token, tm time.Time) Value {
 	return Value{macro, "", uint64(tm.Unix()), typeInt, nil}
 }
 
-// Time creates a new value that replaces `macro` with `tm` formatted according to `layout`
+// Time creates a new value that replaces `macro` with `tm` formatted according to `layout`.
+// Time filters such as `tz(UTC)`, `format(2006-01-02)`, `rfc3339`, `unix`, `unixms` and `unixnano` apply to the time before it is formatted.
 func Time(macro Token, tm time.Time, layout string) Value {
+	if tm.After(minUnixNano) && tm.Before(maxUnixNano) {
+		// Avoid allocating for times within the range of `time.Time.UnixNano`
+		return Value{macro, layout, uint64(tm.UnixNano()), typeTime, tm.Location()}
+	}
 	return Value{macro, layout, 0, typeTime, tm}
 }
 
+var (
+	minUnixNano = time.Unix(0, math.MinInt64)
+	maxUnixNano = time.Unix(0, math.MaxInt64)
+)
+
 // Any creates a new value that replaces `macro` with any value
 func Any(macro Token, x interface{}) Value {
 	if any, ok := x.(ValueAppender); ok {
@@ -139,12 +183,15 @@ func (v *Value) AppendValue(buf []byte) ([]byte, error) {
 	case typeFloat:
 		f := math.Float64frombits(v.num)
 		return strconv.AppendFloat(buf, f, 'f', -1, 64), nil
+	case typeFloat32:
+		f := math.Float64frombits(v.num)
+		return strconv.AppendFloat(buf, f, 'f', -1, 32), nil
 	case typeUint:
 		return strconv.AppendUint(buf, v.num, 10), nil
 	case typeInt:
 		return strconv.AppendInt(buf, int64(v.num), 10), nil
 	case typeTime:
-		return v.any.(time.Time).AppendFormat(buf, v.str), nil
+		return v.time().AppendFormat(buf, v.str), nil
 	case typeConcat:
 		values := v.any.([]string)
 		sep := v.str
@@ -155,18 +202,171 @@ func (v *Value) AppendValue(buf []byte) ([]byte, error) {
 			buf = append(buf, v...)
 		}
 		return buf, nil
+	case typeList:
+		items := v.any.([]Value)
+		for i := range items {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var err error
+			if buf, err = items[i].AppendValue(buf); err != nil {
+				return buf, err
+			}
+		}
+		return buf, nil
 	case typeAny:
 		if v, ok := v.any.(ValueAppender); ok {
 			return v.AppendValue(buf)
 		}
 		return any{v.any}.AppendValue(buf)
-	case typeNone:
+	case typeNone, typeSource:
 		return buf, ErrMacroNotFound
 	default:
 		return nil, errors.New("Invalid value type")
 	}
 }
 
+// Macro returns the macro replaced by the value
+func (v *Value) Macro() Token {
+	return v.macro
+}
+
+// Int returns the value as an integer if it is an integer or an integer string
+func (v *Value) Int() (int64, bool) {
+	switch v.typ {
+	case typeInt:
+		return int64(v.num), true
+	case typeUint:
+		return int64(v.num), v.num <= math.MaxInt64
+	case typeString:
+		i, err := strconv.ParseInt(v.str, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// Float returns the value as a float if it is a number or a numeric string
+func (v *Value) Float() (float64, bool) {
+	switch v.typ {
+	case typeFloat, typeFloat32:
+		return math.Float64frombits(v.num), true
+	case typeInt:
+		return float64(int64(v.num)), true
+	case typeUint:
+		return float64(v.num), true
+	case typeString:
+		f, err := strconv.ParseFloat(v.str, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Time returns the value as a time if it is a time value
+func (v *Value) Time() (time.Time, bool) {
+	if v.typ == typeTime {
+		return v.time(), true
+	}
+	return time.Time{}, false
+}
+
+// Items returns the items of a list value
+func (v *Value) Items() ([]Value, bool) {
+	switch v.typ {
+	case typeList:
+		return v.any.([]Value), true
+	case typeConcat:
+		values := v.any.([]string)
+		items := make([]Value, len(values))
+		for i, s := range values {
+			items[i] = String("", s)
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func (v *Value) time() time.Time {
+	if tm, ok := v.any.(time.Time); ok {
+		return tm
+	}
+	return time.Unix(0, int64(v.num)).In(v.any.(*time.Location))
+}
+
+// sizeHint returns an upper bound for the size of the appended value except for `Any` and `Bind` values
+func (v *Value) sizeHint() int {
+	var scratch [64]byte
+	switch v.typ {
+	case typeNone:
+		return 0
+	case typeString:
+		return len(v.str)
+	case typeUint, typeInt:
+		return 20
+	case typeFloat:
+		return len(strconv.AppendFloat(scratch[:0], math.Float64frombits(v.num), 'f', -1, 64))
+	case typeFloat32:
+		return len(strconv.AppendFloat(scratch[:0], math.Float64frombits(v.num), 'f', -1, 32))
+	case typeTime:
+		return len(v.time().AppendFormat(scratch[:0], v.str))
+	case typeConcat:
+		values := v.any.([]string)
+		n := len(v.str) * len(values)
+		for _, s := range values {
+			n += len(s)
+		}
+		return n
+	case typeList:
+		items := v.any.([]Value)
+		n := len(items)
+		for i := range items {
+			n += items[i].sizeHint()
+		}
+		return n
+	case typeAny:
+		if x, ok := v.any.(any); ok {
+			switch x := x.value.(type) {
+			case string:
+				return len(x)
+			case []byte:
+				return len(x)
+			}
+		}
+		return minBufferSize
+	default:
+		return minBufferSize
+	}
+}
+
+// size returns the number of items a loop section iterates over
+func (v *Value) size() int {
+	switch v.typ {
+	case typeNone:
+		return 0
+	case typeConcat:
+		return len(v.any.([]string))
+	case typeList:
+		return len(v.any.([]Value))
+	default:
+		return 1
+	}
+}
+
+// item returns the i-th loop item bound to `macro`
+func (v *Value) item(macro Token, i int) Value {
+	switch v.typ {
+	case typeConcat:
+		return String(macro, v.any.([]string)[i])
+	case typeList:
+		item := v.any.([]Value)[i]
+		item.macro = macro
+		return item
+	default:
+		item := *v
+		item.macro = macro
+		return item
+	}
+}
+
 // ValueAppender appends a value to a buffer
 type ValueAppender interface {
 	AppendValue([]byte) ([]byte, error)
@@ -214,7 +414,6 @@ func (v any) AppendValue(buf []byte) ([]byte, error) {
 	case fmt.Stringer:
 		return append(buf, v.String()...), nil
 	default:
-		s := fmt.Sprintf("%s", v)
-		return append(buf, s...), nil
+		return fmt.Appendf(buf, "%s", v), nil
 	}
 }
@@ -0,0 +1,554 @@
+package macros
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// LoadConfigYAML reads a YAML configuration from `r`.
+// The `source` name is used in error messages.
+// Only the subset of YAML needed for configurations is supported: block and flow mappings and sequences,
+// plain and quoted scalars and comments. Anchors, aliases, tags, block scalars and multiple documents are an error.
+func LoadConfigYAML(source string, r io.Reader) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c := Config{
+		src: source,
+		pos: make(map[string]Position),
+	}
+	root, err := parseYAML(string(data))
+	if err != nil {
+		e := err.(*yamlError)
+		return nil, &ConfigError{source, e.pos, "", e.err}
+	}
+	if root == nil || root.null {
+		return &c, nil
+	}
+	d := yamlDecoder{src: source, pos: c.pos}
+	if err := d.decode(root, reflect.ValueOf(&c).Elem(), ""); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// LoadOptionsYAML reads a YAML configuration from `r` and converts it to options
+func LoadOptionsYAML(source string, r io.Reader, registry Filters) ([]Option, error) {
+	c, err := LoadConfigYAML(source, r)
+	if err != nil {
+		return nil, err
+	}
+	return c.Options(registry)
+}
+
+const (
+	yamlScalar = iota
+	yamlSequence
+	yamlMapping
+)
+
+type yamlNode struct {
+	kind   int
+	value  string
+	null   bool
+	items  []*yamlNode
+	keys   []string
+	values []*yamlNode
+	pos    Position
+}
+
+type yamlError struct {
+	pos Position
+	err error
+}
+
+func (e *yamlError) Error() string {
+	return e.pos.String() + ": " + e.err.Error()
+}
+
+func yamlErrorf(line, col int, format string, args ...interface{}) error {
+	return &yamlError{Position{line, col}, fmt.Errorf(format, args...)}
+}
+
+type yamlLine struct {
+	indent int
+	text   string
+	line   int
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+// parseYAML parses a YAML document returning nil for empty documents
+func parseYAML(src string) (*yamlNode, error) {
+	var p yamlParser
+	for i, text := range strings.Split(src, "\n") {
+		text = strings.TrimRight(stripYAMLComment(strings.TrimRight(text, "\r")), " \t")
+		content := strings.TrimLeft(text, " ")
+		if content == "" {
+			continue
+		}
+		indent := len(text) - len(content)
+		if content[0] == '\t' {
+			return nil, yamlErrorf(i+1, indent+1, "Tabs are not allowed in indentation")
+		}
+		if content == "---" && len(p.lines) == 0 && indent == 0 {
+			continue
+		}
+		if indent == 0 && (content == "---" || content == "...") {
+			return nil, yamlErrorf(i+1, 1, "Multiple documents are not supported")
+		}
+		p.lines = append(p.lines, yamlLine{indent, content, i + 1})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	root, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		l := p.lines[p.i]
+		return nil, yamlErrorf(l.line, l.indent+1, "Invalid indentation")
+	}
+	return root, nil
+}
+
+// stripYAMLComment removes a comment outside of quoted scalars
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case quote == '"':
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quote = 0
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return s[:i]
+			}
+		case c == '\'' || c == '"':
+			// Quotes only start a scalar at the start of a value
+			if j := strings.TrimRight(s[:i], " \t"); j == "" || strings.IndexByte(":-[{,", j[len(j)-1]) != -1 {
+				quote = c
+			}
+		}
+	}
+	return s
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseBlock(indent int) (*yamlNode, error) {
+	if isYAMLSequenceItem(p.lines[p.i].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	l := p.lines[p.i]
+	node := yamlNode{kind: yamlSequence, pos: Position{l.line, indent + 1}}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && isYAMLSequenceItem(p.lines[p.i].text) {
+		l := p.lines[p.i]
+		rest := strings.TrimLeft(l.text[1:], " ")
+		col := indent + len(l.text) - len(rest)
+		var (
+			item *yamlNode
+			err  error
+		)
+		switch {
+		case rest == "":
+			p.i++
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				item, err = p.parseBlock(p.lines[p.i].indent)
+			} else {
+				item = &yamlNode{null: true, pos: Position{l.line, col + 1}}
+			}
+		case isYAMLSequenceItem(rest):
+			// Nested sequences start on the same line
+			p.lines[p.i] = yamlLine{col, rest, l.line}
+			item, err = p.parseSequence(col)
+		default:
+			if _, _, _, ok := splitYAMLKey(rest); ok {
+				// Mappings in sequences start on the same line as the item
+				p.lines[p.i] = yamlLine{col, rest, l.line}
+				item, err = p.parseMapping(col)
+			} else {
+				item, err = parseYAMLValue(rest, l.line, col+1)
+				p.i++
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	return &node, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	l := p.lines[p.i]
+	node := yamlNode{kind: yamlMapping, pos: Position{l.line, indent + 1}}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent {
+		l := p.lines[p.i]
+		if isYAMLSequenceItem(l.text) {
+			return nil, yamlErrorf(l.line, indent+1, "Unexpected sequence item")
+		}
+		key, rest, offset, ok := splitYAMLKey(l.text)
+		if !ok {
+			if len(node.keys) == 0 {
+				// A block with a single value
+				value, err := parseYAMLValue(l.text, l.line, indent+1)
+				p.i++
+				return value, err
+			}
+			return nil, yamlErrorf(l.line, indent+1, "Expected a mapping key")
+		}
+		for _, k := range node.keys {
+			if k == key {
+				return nil, yamlErrorf(l.line, indent+1, "Duplicate key %q", key)
+			}
+		}
+		p.i++
+		col := indent + offset + 1
+		var (
+			value *yamlNode
+			err   error
+		)
+		switch {
+		case rest != "":
+			value, err = parseYAMLValue(rest, l.line, col)
+		case p.i < len(p.lines) && p.lines[p.i].indent > indent:
+			value, err = p.parseBlock(p.lines[p.i].indent)
+		case p.i < len(p.lines) && p.lines[p.i].indent == indent && isYAMLSequenceItem(p.lines[p.i].text):
+			// Sequences can have the same indentation as their key
+			value, err = p.parseSequence(indent)
+		default:
+			value = &yamlNode{null: true, pos: Position{l.line, col}}
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+		node.values = append(node.values, value)
+	}
+	return &node, nil
+}
+
+// splitYAMLKey splits a `key: value` line returning the offset of the value
+func splitYAMLKey(text string) (key, rest string, offset int, ok bool) {
+	var n int
+	if text[0] == '"' || text[0] == '\'' {
+		var err error
+		if key, n, err = parseYAMLQuoted(text); err != nil {
+			return "", "", 0, false
+		}
+		if n == len(text) || text[n] != ':' {
+			return "", "", 0, false
+		}
+	} else {
+		n = strings.Index(text, ": ")
+		if n == -1 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", 0, false
+			}
+			n = len(text) - 1
+		}
+		key = strings.TrimRight(text[:n], " ")
+		if key == "" || strings.IndexByte("[{&*!|>%@`", key[0]) != -1 {
+			return "", "", 0, false
+		}
+	}
+	rest = strings.TrimLeft(text[n+1:], " ")
+	return key, rest, len(text) - len(rest), true
+}
+
+// parseYAMLValue parses a value on a single line
+func parseYAMLValue(s string, line, col int) (*yamlNode, error) {
+	switch s[0] {
+	case '|', '>':
+		return nil, yamlErrorf(line, col, "Block scalars are not supported")
+	case '&', '*', '!':
+		return nil, yamlErrorf(line, col, "Anchors, aliases and tags are not supported")
+	case '[', '{', '"', '\'':
+		f := yamlFlow{s: s, line: line, col: col}
+		node, err := f.parse(false)
+		if err != nil {
+			return nil, err
+		}
+		if f.skipSpaces(); f.i < len(s) {
+			return nil, yamlErrorf(line, col+f.i, "Unexpected %q", s[f.i:])
+		}
+		return node, nil
+	}
+	return plainYAMLScalar(s, line, col), nil
+}
+
+func plainYAMLScalar(s string, line, col int) *yamlNode {
+	node := yamlNode{value: s, pos: Position{line, col}}
+	switch s {
+	case "~", "null", "Null", "NULL":
+		node.null = true
+	}
+	return &node
+}
+
+// yamlFlow parses flow collections and quoted scalars
+type yamlFlow struct {
+	s    string
+	i    int
+	line int
+	col  int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) errorf(format string, args ...interface{}) error {
+	return yamlErrorf(f.line, f.col+f.i, format, args...)
+}
+
+func (f *yamlFlow) parse(key bool) (*yamlNode, error) {
+	f.skipSpaces()
+	if f.i == len(f.s) {
+		return nil, f.errorf("Unexpected end of flow collection")
+	}
+	pos := Position{f.line, f.col + f.i}
+	switch c := f.s[f.i]; c {
+	case '[', '{':
+		node := yamlNode{kind: yamlSequence, pos: pos}
+		end := byte(']')
+		if c == '{' {
+			node.kind, end = yamlMapping, '}'
+		}
+		f.i++
+		for {
+			if f.skipSpaces(); f.i < len(f.s) && f.s[f.i] == end {
+				f.i++
+				return &node, nil
+			}
+			if node.kind == yamlSequence {
+				item, err := f.parse(false)
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, item)
+			} else {
+				k, err := f.parse(true)
+				if err != nil {
+					return nil, err
+				}
+				if k.kind != yamlScalar {
+					return nil, yamlErrorf(k.pos.Line, k.pos.Column, "Invalid mapping key")
+				}
+				if f.skipSpaces(); f.i == len(f.s) || f.s[f.i] != ':' {
+					return nil, f.errorf("Expected ':'")
+				}
+				f.i++
+				value, err := f.parse(false)
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, k.value)
+				node.values = append(node.values, value)
+			}
+			if f.skipSpaces(); f.i < len(f.s) && f.s[f.i] == ',' {
+				f.i++
+				continue
+			}
+			if f.i < len(f.s) && f.s[f.i] == end {
+				continue
+			}
+			return nil, f.errorf("Expected ',' or '%c'", end)
+		}
+	case '"', '\'':
+		value, n, err := parseYAMLQuoted(f.s[f.i:])
+		if err != nil {
+			return nil, f.errorf("%s", err)
+		}
+		f.i += n
+		return &yamlNode{value: value, pos: pos}, nil
+	case '&', '*', '!', '|', '>':
+		return nil, f.errorf("Anchors, aliases and tags are not supported")
+	}
+	start := f.i
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' || key && c == ':' {
+			break
+		}
+		f.i++
+	}
+	s := strings.TrimRight(f.s[start:f.i], " ")
+	if s == "" {
+		return nil, f.errorf("Missing value")
+	}
+	return plainYAMLScalar(s, pos.Line, pos.Column), nil
+}
+
+var errUnterminatedYAMLString = errors.New("Unterminated quoted scalar")
+
+// parseYAMLQuoted parses a quoted scalar at the start of `s` returning its value and length
+func parseYAMLQuoted(s string) (string, int, error) {
+	if s[0] == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		}
+		return "", 0, errUnterminatedYAMLString
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, errors.New("Invalid escape sequence")
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, errUnterminatedYAMLString
+}
+
+// yamlDecoder decodes YAML nodes to configuration values using their JSON field names
+type yamlDecoder struct {
+	src string
+	pos map[string]Position
+}
+
+func (d *yamlDecoder) decode(n *yamlNode, v reflect.Value, path string) error {
+	d.pos[path] = n.pos
+	if n.null {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := d.decode(n, elem.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.String:
+		if n.kind == yamlScalar {
+			v.SetString(n.value)
+			return nil
+		}
+	case reflect.Bool:
+		if n.kind == yamlScalar {
+			switch n.value {
+			case "true", "True", "TRUE":
+				v.SetBool(true)
+				return nil
+			case "false", "False", "FALSE":
+				v.SetBool(false)
+				return nil
+			}
+		}
+	case reflect.Slice:
+		if n.kind == yamlSequence {
+			s := reflect.MakeSlice(v.Type(), len(n.items), len(n.items))
+			for i, item := range n.items {
+				if err := d.decode(item, s.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+	case reflect.Map:
+		if n.kind == yamlMapping {
+			m := reflect.MakeMapWithSize(v.Type(), len(n.keys))
+			for i, key := range n.keys {
+				value := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decode(n.values[i], value, joinYAMLPath(path, key)); err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
+			}
+			v.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if n.kind == yamlMapping {
+			return d.decodeStruct(n, v, path)
+		}
+	}
+	return &ConfigError{d.src, n.pos, path, fmt.Errorf("Invalid %s value", n.kindName())}
+}
+
+func (d *yamlDecoder) decodeStruct(n *yamlNode, v reflect.Value, path string) error {
+	t := v.Type()
+	for i, key := range n.keys {
+		for j := 0; j < t.NumField(); j++ {
+			field := t.Field(j)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			if name == key {
+				if err := d.decode(n.values[i], v.Field(j), joinYAMLPath(path, key)); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func joinYAMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (n *yamlNode) kindName() string {
+	switch n.kind {
+	case yamlSequence:
+		return "array"
+	case yamlMapping:
+		return "object"
+	}
+	return "string"
+}
@@ -0,0 +1,78 @@
+package macros
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadOptionsYAML(t *testing.T) {
+	src := `---
+# Partner macros
+delimiters: ["{", "}"]
+alias:
+  PRICE:
+  - AUCTION_PRICE
+  - 'price'
+skip: [PARTNER_ID]
+alias_patterns:
+  - pattern: "^X_(.*)$"
+    replacement: $1
+expand:
+  WIN: "{PRICE:hex}" # hex encoded price
+default: "-"
+filters:
+  - hex
+shell: false
+`
+	options, err := LoadOptionsYAML("partner.yaml", strings.NewReader(src), DefaultFilters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(options...)
+	buf, err := r.Replace(nil, "{AUCTION_PRICE} {WIN} {PARTNER_ID} {FOO}", String("PRICE", "\x01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "\x01 01 {PARTNER_ID} -" {
+		t.Errorf("Invalid replacement %q", buf)
+	}
+	c, err := LoadConfigYAML("partner.yaml", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.AliasPatterns) != 1 || c.AliasPatterns[0].Pattern != "^X_(.*)$" || c.AliasPatterns[0].Replacement != "$1" {
+		t.Errorf("Invalid alias patterns %v", c.AliasPatterns)
+	}
+	if c, err := LoadConfigYAML("empty.yaml", strings.NewReader("# empty\n")); err != nil || c.Default != nil {
+		t.Errorf("Invalid empty config %v %v", c, err)
+	}
+}
+
+func TestLoadOptionsYAMLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Src    string
+		Expect string
+	}{
+		{"filters: [hex", "test.yaml:1:14: Expected ',' or ']'"},
+		{"skip: {A: B}", "test.yaml:1:7: skip: Invalid object value"},
+		{"shell: yes", "test.yaml:1:8: shell: Invalid string value"},
+		{"filters:\n  - hex\n  - foo\n", "test.yaml:3:5: filters[1]: Missing macro filter foo"},
+		{"delimiters: ['{']", "test.yaml:1:13: delimiters: Invalid delimiters"},
+		{"alias:\n  A: [X]\n  B: [X]\n", "test.yaml:3:7: alias.B[0]: Alias \"X\" already defined for \"A\""},
+		{"expand:\n  A: \"${B\"\n", "test.yaml:2:6: expand.A: Unmatched delimiter \"${\" at position 0"},
+		{"skip: [A]\nskip: [B]\n", "test.yaml:2:1: Duplicate key \"skip\""},
+		{"skip:\n  - A\n - B\n", "test.yaml:3:2: Invalid indentation"},
+		{"default: &d x", "test.yaml:1:10: Anchors, aliases and tags are not supported"},
+		{"default: |\n  x\n", "test.yaml:1:10: Block scalars are not supported"},
+		{"default: 'x", "test.yaml:1:10: Unterminated quoted scalar"},
+		{"shell: true\n---\nshell: false\n", "test.yaml:2:1: Multiple documents are not supported"},
+		{"skip:\n\t- A\n", "test.yaml:2:1: Tabs are not allowed in indentation"},
+	} {
+		_, err := LoadOptionsYAML("test.yaml", strings.NewReader(tc.Src), DefaultFilters())
+		if err == nil {
+			t.Errorf("Expected error for %q", tc.Src)
+		} else if err.Error() != tc.Expect {
+			t.Errorf("Invalid error %q != %q", err, tc.Expect)
+		}
+	}
+}